@@ -0,0 +1,222 @@
+// Package client is a Go client for the siphon HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Zac-Garby/siphon/db"
+)
+
+// Params maps the names of variables used in a selector, without the leading
+// '$', to their values. The values must be encodable as JSON.
+type Params map[string]interface{}
+
+// A Client makes requests to a siphon server. It is safe to use from multiple
+// goroutines, and reuses connections between requests.
+type Client struct {
+	// Addr is the base URL of the server, e.g. "http://localhost:7913".
+	Addr string
+
+	// HTTP is the HTTP client used to make requests.
+	HTTP *http.Client
+}
+
+// NewClient makes a new client for the server at addr, e.g.
+// "http://localhost:7913".
+func NewClient(addr string) *Client {
+	return &Client{
+		Addr: strings.TrimRight(addr, "/"),
+		HTTP: &http.Client{},
+	}
+}
+
+// Get queries the database with a selector, decoding the JSON result into out
+// in the same way as json.Unmarshal.
+func (c *Client) Get(ctx context.Context, selector string, params Params, out interface{}) error {
+	body, err := c.do(ctx, "GET", "json", selector, params, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// Set sets the value of the selected item.
+func (c *Client) Set(ctx context.Context, selector string, params Params, value interface{}) error {
+	return c.post(ctx, db.ActionSet, selector, params, value)
+}
+
+// Unset removes the given key or index from the selected list or hashmap.
+func (c *Client) Unset(ctx context.Context, selector string, params Params, key interface{}) error {
+	return c.post(ctx, db.ActionUnset, selector, params, key)
+}
+
+// Append appends a value to the selected list.
+func (c *Client) Append(ctx context.Context, selector string, params Params, value interface{}) error {
+	return c.post(ctx, db.ActionAppend, selector, params, value)
+}
+
+// Prepend prepends a value to the selected list.
+func (c *Client) Prepend(ctx context.Context, selector string, params Params, value interface{}) error {
+	return c.post(ctx, db.ActionPrepend, selector, params, value)
+}
+
+// Key sets the given key of the selected item to a value.
+func (c *Client) Key(ctx context.Context, selector string, params Params, key, value interface{}) error {
+	return c.post(ctx, db.ActionKey, selector, params, map[string]interface{}{
+		"key":   key,
+		"value": value,
+	})
+}
+
+// Empty removes every element from the selected list or hashmap.
+func (c *Client) Empty(ctx context.Context, selector string, params Params) error {
+	_, err := c.do(ctx, "POST", string(db.ActionEmpty), selector, params, nil)
+	return err
+}
+
+// Update sets fields of every element of the selected list or hashmap. The
+// update is either a map of fields to their new values, or a string of
+// assignments like "likes += 1".
+func (c *Client) Update(ctx context.Context, selector string, params Params, update interface{}) error {
+	return c.post(ctx, db.ActionUpdate, selector, params, update)
+}
+
+// Delete removes every element of a list or hashmap which matches the last
+// filter of the selector, e.g. "todos[completed]", and returns how many were
+// removed.
+func (c *Client) Delete(ctx context.Context, selector string, params Params) (removed int, err error) {
+	body, err := c.do(ctx, "POST", string(db.ActionDelete), selector, params, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var res struct {
+		Removed int `json:"removed"`
+	}
+
+	if err := json.Unmarshal(body, &res); err != nil {
+		return 0, err
+	}
+
+	return res.Removed, nil
+}
+
+// Incr adds by to the selected number, and decodes its new value into out,
+// unless out is nil. The number can't be modified in between.
+func (c *Client) Incr(ctx context.Context, selector string, params Params, by interface{}, out interface{}) error {
+	return c.numeric(ctx, db.ActionIncr, selector, params, by, out)
+}
+
+// Decr subtracts by from the selected number, and decodes its new value into
+// out, unless out is nil.
+func (c *Client) Decr(ctx context.Context, selector string, params Params, by interface{}, out interface{}) error {
+	return c.numeric(ctx, db.ActionDecr, selector, params, by, out)
+}
+
+// Min sets the selected number to the smaller of its current value and value,
+// and decodes its new value into out, unless out is nil.
+func (c *Client) Min(ctx context.Context, selector string, params Params, value interface{}, out interface{}) error {
+	return c.numeric(ctx, db.ActionMin, selector, params, value, out)
+}
+
+// Max sets the selected number to the larger of its current value and value,
+// and decodes its new value into out, unless out is nil.
+func (c *Client) Max(ctx context.Context, selector string, params Params, value interface{}, out interface{}) error {
+	return c.numeric(ctx, db.ActionMax, selector, params, value, out)
+}
+
+func (c *Client) numeric(ctx context.Context, action db.Action, selector string, params Params, value interface{}, out interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.do(ctx, "POST", string(action), selector, params, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+func (c *Client) post(ctx context.Context, action db.Action, selector string, params Params, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, "POST", string(action), selector, params, bytes.NewReader(encoded))
+	return err
+}
+
+// do makes a request to the given route, returning the response body. If
+// the server responds with an error, it is returned as a *db.Error.
+func (c *Client) do(ctx context.Context, method, route, selector string, params Params, body io.Reader) ([]byte, error) {
+	u, err := url.Parse(c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("addr parser: %s", err.Error())
+	}
+
+	u.Path = "/" + route
+
+	// the server unescapes the selector after decoding the form, so it
+	// needs to be escaped twice
+	q := u.Query()
+	q.Set("selector", url.QueryEscape(selector))
+
+	if len(params) > 0 {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Set("params", string(encoded))
+	}
+
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	// the body is always read to the end, so the connection can be reused
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %s", err.Error())
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return respBody, nil
+
+	case http.StatusInternalServerError:
+		return nil, decodeError(respBody)
+
+	default:
+		return nil, fmt.Errorf("http err: %s", resp.Status)
+	}
+}
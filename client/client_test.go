@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Zac-Garby/siphon/db"
+)
+
+func TestDecodeError(t *testing.T) {
+	cases := []struct {
+		body    string
+		ty      db.ErrorType
+		message string
+	}{
+		{`{"err": "[index error] index out of bounds"}`, db.ErrIndex, "index out of bounds"},
+		{`{"err": "[invalid type] expected a list value"}`, db.ErrType, "expected a list value"},
+		{`{"err": "[no operation] division by zero"}`, db.ErrNOOP, "division by zero"},
+		{`{"err": "[undefined type] foo"}`, db.ErrNoType, "foo"},
+		{`{"err": "[error] could not decode snapshot"}`, db.ErrUnknown, "could not decode snapshot"},
+		{`{"err": "<source>:1:7: unexpected \"]\""}`, db.ErrUnknown, `<source>:1:7: unexpected "]"`},
+		{`not json`, db.ErrUnknown, "unknown error, response not JSON parseable: not json"},
+	}
+
+	for _, c := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, c.body)
+		}))
+
+		err := NewClient(ts.URL).Get(context.Background(), "users", nil, nil)
+		ts.Close()
+
+		e, ok := err.(*db.Error)
+		if !ok {
+			t.Errorf("%s: expected a *db.Error, but got %#v", c.body, err)
+			continue
+		}
+
+		if e.Type != c.ty || e.Message != c.message {
+			t.Errorf("%s: got [%s] %q, want [%s] %q", c.body, e.Type, e.Message, c.ty, c.message)
+		}
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	var (
+		started  = make(chan struct{})
+		finished = make(chan struct{})
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(finished)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	err := NewClient(ts.URL).Get(ctx, "users", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("expected the request to be cancelled, but got %v", err)
+	}
+
+	// the server sees the request being cancelled too
+	<-finished
+}
+
+func TestReuseConnection(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			fmt.Fprint(w, "[1, 2, 3]")
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"err": "[invalid type] expected an integer value"}`)
+	}))
+
+	var (
+		mu    sync.Mutex
+		conns int
+	)
+
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+
+	ts.Start()
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		var nums []int
+		if err := c.Get(ctx, "nums", nil, &nums); err != nil {
+			t.Fatal(err)
+		}
+
+		// error responses are read to the end too, so they don't stop
+		// the connection from being reused
+		if err := c.Append(ctx, "nums", nil, "x"); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if conns != 1 {
+		t.Errorf("made %d connections, want 1", conns)
+	}
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Zac-Garby/siphon/db"
+)
+
+var errorTypes = []db.ErrorType{
+	db.ErrNOOP,
+	db.ErrIndex,
+	db.ErrUnknown,
+	db.ErrType,
+	db.ErrNoType,
+}
+
+// decodeError decodes an error response, of the form {"err": "..."}, into a
+// *db.Error. Database errors are formatted like "[index error] message", so
+// the type can be recovered from the start of the message. Any other errors,
+// such as selector syntax errors, have the type db.ErrUnknown.
+func decodeError(body []byte) error {
+	resp := struct {
+		Err string `json:"err"`
+	}{}
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &db.Error{
+			Type:    db.ErrUnknown,
+			Message: "unknown error, response not JSON parseable: " + string(body),
+		}
+	}
+
+	for _, t := range errorTypes {
+		prefix := "[" + string(t) + "] "
+
+		if strings.HasPrefix(resp.Err, prefix) {
+			return &db.Error{
+				Type:    t,
+				Message: strings.TrimPrefix(resp.Err, prefix),
+			}
+		}
+	}
+
+	return &db.Error{
+		Type:    db.ErrUnknown,
+		Message: resp.Err,
+	}
+}
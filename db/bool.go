@@ -49,12 +49,21 @@ func (b *Bool) Compare(kind Comparison, other Item) (result bool, err error) {
 		return false, nil
 	}
 
+	// for ordering, false is less than true
 	switch kind {
 	case Equal:
 		return b.value == ob.value, nil
 	case NotEqual:
 		return b.value != ob.value, nil
+	case Less:
+		return !b.value && ob.value, nil
+	case More:
+		return b.value && !ob.value, nil
+	case LessOrEqual:
+		return !b.value || ob.value, nil
+	case MoreOrEqual:
+		return b.value || !ob.value, nil
 	default:
-		return false, newError(ErrNOOP, "only = and != are supported on booleans")
+		return false, newError(ErrNOOP, "only =, !=, <, >, <=, and >= are supported on booleans")
 	}
 }
@@ -0,0 +1,124 @@
+package db
+
+// copyItem makes a deep copy of an item, so that modifying the copy doesn't
+// affect the original, or vice versa.
+func copyItem(item Item) Item {
+	switch it := item.(type) {
+	case *Struct:
+		s := &Struct{
+			ty:    it.ty,
+			value: make(map[string]Item, len(it.value)),
+		}
+
+		for name, val := range it.value {
+			s.value[name] = copyItem(val)
+		}
+
+		return s
+
+	case *List:
+		l := &List{
+			valType: it.valType,
+			value:   make([]Item, len(it.value)),
+		}
+
+		for i, val := range it.value {
+			l.value[i] = copyItem(val)
+		}
+
+		return l
+
+	case *Hashmap:
+		h := &Hashmap{
+			keyType: it.keyType,
+			valType: it.valType,
+			data:    make(map[string]Item, len(it.data)),
+			keys:    make(map[string]Item, len(it.keys)),
+		}
+
+		for hash, val := range it.data {
+			h.data[hash] = copyItem(val)
+			h.keys[hash] = copyItem(it.keys[hash])
+		}
+
+		return h
+
+	case *Float:
+		return NewFloat(it.value)
+	case *Float32:
+		return NewFloat32(it.value)
+
+	case *Int:
+		return NewInt(it.value)
+	case *Int32:
+		return NewInt32(it.value)
+	case *Int16:
+		return NewInt16(it.value)
+	case *Int8:
+		return NewInt8(it.value)
+
+	case *Uint:
+		return NewUint(it.value)
+	case *Uint32:
+		return NewUint32(it.value)
+	case *Uint16:
+		return NewUint16(it.value)
+	case *Uint8:
+		return NewUint8(it.value)
+
+	case *String:
+		return NewString(it.value)
+	case *Bool:
+		return NewBool(it.value)
+	case *Regexp:
+		return NewRegexp(it.value)
+
+	default:
+		return item
+	}
+}
+
+// restoreItem puts the contents of backup, which was made by copyItem, back
+// into item. The item is modified in place, rather than replaced, so anything
+// which refers to it, like the struct containing it, isn't written to.
+func restoreItem(item, backup Item) {
+	switch it := item.(type) {
+	case *Struct:
+		it.value = backup.(*Struct).value
+	case *List:
+		it.value = backup.(*List).value
+	case *Hashmap:
+		b := backup.(*Hashmap)
+		it.data, it.keys = b.data, b.keys
+
+	case *Float:
+		it.value = backup.(*Float).value
+	case *Float32:
+		it.value = backup.(*Float32).value
+
+	case *Int:
+		it.value = backup.(*Int).value
+	case *Int32:
+		it.value = backup.(*Int32).value
+	case *Int16:
+		it.value = backup.(*Int16).value
+	case *Int8:
+		it.value = backup.(*Int8).value
+
+	case *Uint:
+		it.value = backup.(*Uint).value
+	case *Uint32:
+		it.value = backup.(*Uint32).value
+	case *Uint16:
+		it.value = backup.(*Uint16).value
+	case *Uint8:
+		it.value = backup.(*Uint8).value
+
+	case *String:
+		it.value = backup.(*String).value
+	case *Bool:
+		it.value = backup.(*Bool).value
+	case *Regexp:
+		it.value = backup.(*Regexp).value
+	}
+}
@@ -1,12 +1,47 @@
 package db
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
 
 // A DB stores all the information about a database, and the data inside
 // it. A DB is created from a Schema.
+//
+// The Read and Apply methods are safe to use from multiple goroutines. Each
+// top-level field has its own lock, so operations on different fields can run
+// at the same time. The lower level methods, like Query, don't lock anything.
 type DB struct {
 	data    *Struct
 	structs map[string]*StructType
+
+	// mu is held for reading by every operation, and for writing by
+	// operations which use the whole database, like saving a snapshot.
+	mu sync.RWMutex
+
+	// fields holds a lock for each top-level field.
+	fields map[string]*sync.RWMutex
+
+	// seqMu protects seq and the log, which are shared between all fields.
+	seqMu sync.Mutex
+
+	// seq is the sequence number of the last operation applied.
+	seq uint64
+
+	// log and dir are set once the database has been restored from a data
+	// directory. Until then, operations aren't logged.
+	log *Log
+	dir string
+
+	// references maps each top-level field to the top-level fields which
+	// annotated fields inside it refer to.
+	references map[string][]string
+
+	// CheckReferences makes Apply check that every annotated ID refers to
+	// something which exists, after any operation which might affect it. If
+	// not, the operation is undone and an error is returned.
+	CheckReferences bool
 }
 
 // JSON represents JSON data.
@@ -26,6 +61,7 @@ func MakeDB(schema *Schema) (db *DB, err error) {
 		str := &StructType{
 			Name:   secStruct.Name,
 			Fields: make(map[string]Type),
+			Refs:   make(map[string]string),
 		}
 		structs[secStruct.Name] = str
 
@@ -35,10 +71,17 @@ func MakeDB(schema *Schema) (db *DB, err error) {
 				return nil, fmt.Errorf("db init: type '%s' does not exist", field.Type.Ident)
 			}
 			str.Fields[field.Name] = ty
+
+			if field.Reference != "" {
+				str.Refs[field.Name] = field.Reference
+			}
 		}
 	}
 
-	fields := make(map[string]Type)
+	var (
+		fields = make(map[string]Type)
+		refs   = make(map[string]string)
+	)
 
 	for _, section := range schema.Sections {
 		field := section.Field
@@ -51,24 +94,68 @@ func MakeDB(schema *Schema) (db *DB, err error) {
 			return nil, fmt.Errorf("db init: type '%s' does not exist", field.Type.Ident)
 		}
 		fields[field.Name] = ty
+
+		if field.Reference != "" {
+			refs[field.Name] = field.Reference
+		}
 	}
 
 	structType := &StructType{
 		Name:   "db",
 		Fields: fields,
+		Refs:   refs,
+	}
+
+	references, err := findReferences(structType)
+	if err != nil {
+		return nil, err
+	}
+
+	locks := make(map[string]*sync.RWMutex, len(fields))
+	for name := range fields {
+		locks[name] = &sync.RWMutex{}
 	}
 
 	return &DB{
-		data: NewStruct(structType),
+		data:       NewStruct(structType),
+		fields:     locks,
+		references: references,
 	}, nil
 }
 
-// Query queries a database with a selector.
+// Query queries a database with a selector. It doesn't lock the database, so
+// Read should be used instead if the database might be modified at the same
+// time.
 func (d *DB) Query(selector *Selector) (result Item, err error) {
+	return d.QueryWithParams(selector, nil)
+}
+
+// QueryWithParams queries a database with a selector, using the given params
+// as the values of any variables in the selector.
+func (d *DB) QueryWithParams(selector *Selector, params Params) (result Item, err error) {
+	if call := selector.Call; call != nil {
+		result, err = d.QueryWithParams(call.Selector, params)
+		if err != nil {
+			return nil, err
+		}
+
+		return callMethod(result, &SelectorMethod{Name: call.Name}, params)
+	}
+
 	result = d.data
 
-	for _, clause := range selector.Clauses {
-		result, err = d.QuerySelectorClause(result, clause)
+	for i, clause := range selector.Clauses {
+		if i > 0 && clause.Link == "" {
+			return nil, newError(ErrNOOP, "expected . or -> between clauses %d and %d", i, i+1)
+		} else if i == 0 && clause.Link == "->" {
+			return nil, newError(ErrNOOP, "a selector cannot start with ->")
+		}
+
+		if clause.Link == ".." && clause.Ident == "" && !clause.Wildcard {
+			return nil, newError(ErrNOOP, ".. must be followed by the name of a field or *")
+		}
+
+		result, err = d.QuerySelectorClause(result, clause, params)
 		if err != nil {
 			return
 		}
@@ -78,47 +165,102 @@ func (d *DB) Query(selector *Selector) (result Item, err error) {
 }
 
 // QuerySelectorClause queries an item
-func (d *DB) QuerySelectorClause(item Item, clause *SelectorClause) (result Item, err error) {
-	result, err = item.GetField(clause.Ident)
-	if err != nil {
-		return nil, err
+func (d *DB) QuerySelectorClause(item Item, clause *SelectorClause, params Params) (result Item, err error) {
+	result = item
+
+	if clause.Link == "->" {
+		if clause.Ident == "" {
+			return nil, newError(ErrNOOP, "-> must be followed by the name of a top-level field")
+		}
+
+		result, err = d.dereference(item, clause.Ident)
+		if err != nil {
+			return nil, err
+		}
+	} else if clause.Link == ".." {
+		result, err = descend(item, clause.Ident)
+		if err != nil {
+			return nil, err
+		}
+	} else if clause.Wildcard {
+		result, err = wildcard(item)
+		if err != nil {
+			return nil, err
+		}
+	} else if clause.Method != nil {
+		result, err = callMethod(item, clause.Method, params)
+		if err != nil {
+			return nil, err
+		}
+	} else if clause.Ident != "" {
+		result, err = item.GetField(clause.Ident)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	for _, filter := range clause.Filters {
-		if cmp := filter.Comparison; cmp != nil {
-			field := cmp.Ident
+		if filter.Slice {
+			start, end, err := sliceBounds(filter, params)
+			if err != nil {
+				return nil, err
+			}
 
-			comparison, ok := stringToComparison(cmp.Comparison)
-			if !ok {
-				return nil, newError(ErrNOOP, "invalid comparison operator: %s", cmp.Comparison)
+			result, err = result.Slice(start, end)
+			if err != nil {
+				return nil, err
 			}
 
-			other := selectorLiteralToItem(cmp.Literal)
+			continue
+		}
+
+		eval, isConstant, err := filterToEvaluator(filter, result.Type(), params)
+		if err != nil {
+			return nil, err
+		}
 
-			result, err = result.Filter(field, comparison, other)
+		if isConstant {
+			key, err := eval(nil)
 			if err != nil {
 				return nil, err
 			}
-		} else if idx := filter.Index; idx != nil {
-			key := selectorLiteralToItem(idx)
 
 			result, err = result.GetKey(key)
 			if err != nil {
 				return nil, err
 			}
+		} else {
+			result, err = result.Filter(evaluatorToPredicate(eval))
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	if clause.Projection != nil {
+		return result.Project(clause.Projection.Fields)
+	}
+
 	return result, nil
 }
 
 func selectorLiteralToItem(lit *SelectorLiteral) Item {
 	if num := lit.Number; num != nil {
-		return NewFloat(*num)
+		return numberToItem(json.Number(*num))
 	} else if str := lit.String; str != nil {
 		return NewString(*str)
 	} else if reg := lit.Regexp; reg != nil {
 		return NewRegexp(*reg)
+	} else if b := lit.Bool; b != nil {
+		return NewBool(*b == "true")
+	} else if lit.Null {
+		return NewNull()
+	} else if l := lit.List; l != nil {
+		list := NewList(&AnyType{})
+		for _, elem := range l.Elements {
+			list.Append(selectorLiteralToItem(elem))
+		}
+		return list
 	}
 	return nil
 }
@@ -126,10 +268,45 @@ func selectorLiteralToItem(lit *SelectorLiteral) Item {
 // QueryString queries a database, parsing the string as
 // as selector first.
 func (d *DB) QueryString(str string) (result Item, err error) {
-	selector := &Selector{}
+	return d.QueryStringWithParams(str, nil)
+}
+
+// QueryStringWithParams queries a database, parsing the string as a selector
+// first, and using the given params as the values of any variables in it.
+func (d *DB) QueryStringWithParams(str string, params Params) (result Item, err error) {
+	selector, err := parseSelector(str)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.QueryWithParams(selector, params)
+}
+
+// Read queries the database and calls fn with the result. The selected data
+// can't be modified until fn returns, and fn shouldn't keep a reference to
+// the result after that.
+func (d *DB) Read(str string, params Params, fn func(result Item) error) (err error) {
+	selector, err := parseSelector(str)
+	if err != nil {
+		return err
+	}
+
+	unlock := d.lockFields(selector.Fields(), false)
+	defer unlock()
+
+	result, err := d.QueryWithParams(selector, params)
+	if err != nil {
+		return err
+	}
+
+	return fn(result)
+}
+
+func parseSelector(str string) (selector *Selector, err error) {
+	selector = &Selector{}
 	if err := SelectorParser.ParseString(str, selector); err != nil {
 		return nil, err
 	}
 
-	return d.Query(selector)
+	return selector, nil
 }
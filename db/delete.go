@@ -0,0 +1,73 @@
+package db
+
+// deleteWhere removes every element matching the last filter of a selector from
+// the list or hashmap selected by the rest of it, returning how many were
+// removed. The rest of the selector is found with target, and can't filter or
+// slice, like "users[3].posts[likes = 0]", to make sure the elements are removed
+// from the one which is actually in the database.
+func (d *DB) deleteWhere(selector *Selector, params Params) (removed int, err error) {
+	if selector.Call != nil || len(selector.Clauses) == 0 {
+		return 0, newError(ErrNOOP, "cannot delete from the result of a method")
+	}
+
+	last := selector.Clauses[len(selector.Clauses)-1]
+	if len(last.Filters) == 0 {
+		return 0, newError(ErrNOOP, "the selector of a delete must end with a filter, like todos[completed]")
+	}
+
+	toDelete := last.Filters[len(last.Filters)-1]
+	if toDelete.Slice {
+		return 0, newError(ErrNOOP, "cannot delete a slice")
+	}
+
+	// the selector without its last filter
+	rest := *last
+	rest.Filters = last.Filters[:len(last.Filters)-1]
+
+	clauses := append([]*SelectorClause{}, selector.Clauses[:len(selector.Clauses)-1]...)
+	clauses = append(clauses, &rest)
+
+	item, copied, err := d.target(&Selector{Clauses: clauses}, params)
+	if err != nil {
+		return 0, err
+	}
+
+	if copied {
+		return 0, newError(ErrNOOP, "only the last filter of a delete can refer to the item being filtered, and it cannot delete from a slice or the result of ->")
+	}
+
+	eval, isConstant, err := filterToEvaluator(toDelete, item.Type(), params)
+	if err != nil {
+		return 0, err
+	}
+
+	if isConstant {
+		key, err := eval(nil)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := item.UnsetKey(key); err != nil {
+			return 0, err
+		}
+
+		return 1, nil
+	}
+
+	return item.Delete(evaluatorToPredicate(eval))
+}
+
+// mapsFields checks whether getting a field of an item gets that field of each
+// of its elements, making a new list.
+func mapsFields(item Item) bool {
+	switch it := item.(type) {
+	case *List:
+		return true
+
+	case *Hashmap:
+		_, ok := it.keyType.(*StringType)
+		return !ok
+	}
+
+	return false
+}
@@ -0,0 +1,136 @@
+package db
+
+import "sort"
+
+// maxDepth is how many levels deep ".." searches inside an item. Anything
+// deeper than that is almost certainly a mistake, or a cycle.
+const maxDepth = 64
+
+// wildcard returns a list of the values of every field of a struct, ordered
+// by name, or of every value of a hashmap. For a list, the wildcard is taken
+// of each element, and the results are flattened into one list.
+func wildcard(item Item) (result Item, err error) {
+	switch it := item.(type) {
+	case *Struct:
+		return NewList(&AnyType{}, children(it)...), nil
+
+	case *Hashmap:
+		vals, ty, err := elements(it)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewList(ty, vals...), nil
+
+	case *List:
+		list := NewList(&AnyType{})
+
+		for _, elem := range it.value {
+			vals, err := wildcard(elem)
+			if err != nil {
+				return nil, err
+			}
+
+			list.value = append(list.value, vals.(*List).value...)
+		}
+
+		return list, nil
+	}
+
+	return nil, newError(ErrNOOP, "cannot use * on a %s", item.Type())
+}
+
+// descend finds the field named key of anything inside item, at any depth,
+// returning a list of the values found. Structs and hashmaps with string keys
+// are searched for the field. If key is empty, every value inside item is
+// returned instead.
+func descend(item Item, key string) (result Item, err error) {
+	var (
+		found   = NewList(&AnyType{})
+		visited = make(map[Item]bool)
+		visit   func(item Item, depth int) error
+	)
+
+	visit = func(item Item, depth int) error {
+		if depth > maxDepth {
+			return newError(ErrNOOP, "cannot search more than %d levels deep", maxDepth)
+		}
+
+		if visited[item] {
+			return nil
+		}
+
+		visited[item] = true
+
+		if key != "" {
+			if val, ok := fieldIfExists(item, key); ok {
+				found.value = append(found.value, val)
+			}
+		}
+
+		for _, child := range children(item) {
+			if key == "" {
+				found.value = append(found.value, child)
+			}
+
+			if err := visit(child, depth+1); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := visit(item, 0); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// children returns the items directly inside an item: the fields of a
+// struct, ordered by name, or the elements of a list or hashmap.
+func children(item Item) (items []Item) {
+	switch it := item.(type) {
+	case *Struct:
+		names := make([]string, 0, len(it.value))
+		for name := range it.value {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		items = make([]Item, len(names))
+		for i, name := range names {
+			items[i] = it.value[name]
+		}
+
+		return items
+
+	case *List, *Hashmap:
+		items, _, _ = elements(it)
+		return items
+	}
+
+	return nil
+}
+
+// fieldIfExists gets a field of a struct, or a value of a hashmap with string
+// keys, if it exists.
+func fieldIfExists(item Item, key string) (val Item, ok bool) {
+	switch it := item.(type) {
+	case *Struct:
+		val, ok = it.value[key]
+		return val, ok
+
+	case *Hashmap:
+		if _, isString := it.keyType.(*StringType); !isString {
+			return nil, false
+		}
+
+		val, err := it.GetKey(NewString(key))
+		return val, err == nil
+	}
+
+	return nil, false
+}
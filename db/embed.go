@@ -0,0 +1,237 @@
+package db
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Open opens a database using the schema in the file schemaFile. If dir isn't
+// empty, the database is restored from that data directory and every
+// modification is logged to it. Otherwise, it's only stored in memory.
+func Open(schemaFile, dir string) (db *DB, err error) {
+	schema, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenString(string(schema), dir)
+}
+
+// OpenString is like Open, but takes the schema itself instead of the name of
+// a file containing it.
+func OpenString(schema, dir string) (db *DB, err error) {
+	sch := &Schema{}
+	if err := SchemaParser.ParseString(schema, sch); err != nil {
+		return nil, err
+	}
+
+	db, err = MakeDB(sch)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		if err := db.Restore(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// Get queries the database and decodes the JSON representation of the result
+// into out, in the same way as json.Unmarshal. Any variables in the selector
+// are taken from params.
+func (d *DB) Get(selector string, params map[string]interface{}, out interface{}) (err error) {
+	p, err := normaliseParams(params)
+	if err != nil {
+		return err
+	}
+
+	var encoded string
+
+	err = d.Read(selector, p, func(result Item) error {
+		encoded = result.JSON()
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(encoded), out)
+}
+
+// Set sets the value of the selected item.
+func (d *DB) Set(selector string, params map[string]interface{}, value interface{}) (err error) {
+	return d.applyValue(ActionSet, selector, params, value)
+}
+
+// Unset removes the given key or index from the selected list or hashmap.
+func (d *DB) Unset(selector string, params map[string]interface{}, key interface{}) (err error) {
+	return d.applyValue(ActionUnset, selector, params, key)
+}
+
+// Append appends a value to the selected list.
+func (d *DB) Append(selector string, params map[string]interface{}, value interface{}) (err error) {
+	return d.applyValue(ActionAppend, selector, params, value)
+}
+
+// Prepend prepends a value to the selected list.
+func (d *DB) Prepend(selector string, params map[string]interface{}, value interface{}) (err error) {
+	return d.applyValue(ActionPrepend, selector, params, value)
+}
+
+// Key sets the given key of the selected item to a value.
+func (d *DB) Key(selector string, params map[string]interface{}, key, value interface{}) (err error) {
+	return d.applyValue(ActionKey, selector, params, map[string]interface{}{
+		"key":   key,
+		"value": value,
+	})
+}
+
+// Empty removes every element from the selected list or hashmap.
+func (d *DB) Empty(selector string, params map[string]interface{}) (err error) {
+	return d.applyValue(ActionEmpty, selector, params, nil)
+}
+
+// Update sets fields of every element of the selected list or hashmap. The
+// update is either a map of fields to their new values, or a string of
+// assignments like "likes += 1".
+func (d *DB) Update(selector string, params map[string]interface{}, update interface{}) (err error) {
+	return d.applyValue(ActionUpdate, selector, params, update)
+}
+
+// Delete removes every element of a list or hashmap which matches the last
+// filter of the selector, e.g. "todos[completed]", and returns how many were
+// removed.
+func (d *DB) Delete(selector string, params map[string]interface{}) (removed int, err error) {
+	op, err := normalise(&Operation{
+		Action:   ActionDelete,
+		Selector: selector,
+		Params:   params,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.Apply(op); err != nil {
+		return 0, err
+	}
+
+	return op.Removed, nil
+}
+
+// Incr adds by to the selected number, and decodes its new value into out,
+// unless out is nil. The number can't be modified in between.
+func (d *DB) Incr(selector string, params map[string]interface{}, by interface{}, out interface{}) (err error) {
+	return d.applyNumeric(ActionIncr, selector, params, by, out)
+}
+
+// Decr subtracts by from the selected number, and decodes its new value into
+// out, unless out is nil.
+func (d *DB) Decr(selector string, params map[string]interface{}, by interface{}, out interface{}) (err error) {
+	return d.applyNumeric(ActionDecr, selector, params, by, out)
+}
+
+// Min sets the selected number to the smaller of its current value and value,
+// and decodes its new value into out, unless out is nil.
+func (d *DB) Min(selector string, params map[string]interface{}, value interface{}, out interface{}) (err error) {
+	return d.applyNumeric(ActionMin, selector, params, value, out)
+}
+
+// Max sets the selected number to the larger of its current value and value,
+// and decodes its new value into out, unless out is nil.
+func (d *DB) Max(selector string, params map[string]interface{}, value interface{}, out interface{}) (err error) {
+	return d.applyNumeric(ActionMax, selector, params, value, out)
+}
+
+// Transaction applies a list of operations, either all of them or none of
+// them.
+func (d *DB) Transaction(ops ...*Operation) (err error) {
+	return d.applyNormalised(&Operation{
+		Action:     ActionTransaction,
+		Operations: ops,
+	})
+}
+
+func (d *DB) applyValue(action Action, selector string, params map[string]interface{}, value interface{}) (err error) {
+	return d.applyNormalised(&Operation{
+		Action:   action,
+		Selector: selector,
+		Params:   params,
+		Payload:  value,
+	})
+}
+
+func (d *DB) applyNumeric(action Action, selector string, params map[string]interface{}, value interface{}, out interface{}) (err error) {
+	op, err := normalise(&Operation{
+		Action:   action,
+		Selector: selector,
+		Params:   params,
+		Payload:  value,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := d.Apply(op); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(op.Result), out)
+}
+
+// applyNormalised normalises an operation and then applies it.
+func (d *DB) applyNormalised(op *Operation) (err error) {
+	normalised, err := normalise(op)
+	if err != nil {
+		return err
+	}
+
+	return d.Apply(normalised)
+}
+
+// normalise converts the params and payloads in an operation to the values
+// they'd be decoded to from JSON, e.g. structs to maps and ints to
+// json.Numbers.
+// This way, the operation is applied in exactly the same way as when it's
+// replayed from the log.
+func normalise(op *Operation) (normalised *Operation, err error) {
+	encoded, err := json.Marshal(op)
+	if err != nil {
+		return nil, newError(ErrType, "could not encode operation: %s", err.Error())
+	}
+
+	normalised = &Operation{}
+	if err := DecodeJSON(encoded, normalised); err != nil {
+		return nil, newError(ErrType, "could not decode operation: %s", err.Error())
+	}
+
+	return normalised, nil
+}
+
+// normaliseParams converts Go values to Params, by way of JSON.
+func normaliseParams(params map[string]interface{}) (p Params, err error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, newError(ErrType, "could not encode params: %s", err.Error())
+	}
+
+	var decoded map[string]interface{}
+	if err := DecodeJSON(encoded, &decoded); err != nil {
+		return nil, newError(ErrType, "could not decode params: %s", err.Error())
+	}
+
+	return ParamsFromJSON(decoded)
+}
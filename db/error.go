@@ -19,3 +19,10 @@ func newError(t ErrorType, msg string, args ...interface{}) error {
 		Message: fmt.Sprintf(msg, args...),
 	}
 }
+
+// isMissing checks whether an error was caused by a field or key which doesn't
+// exist.
+func isMissing(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Type == ErrIndex
+}
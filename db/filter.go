@@ -0,0 +1,465 @@
+package db
+
+import (
+	"math"
+	"strings"
+)
+
+// An evaluator computes the value of an expression in a filter, given the
+// item being filtered.
+type evaluator func(item Item) (result Item, err error)
+
+// filterToEvaluator converts a parsed filter into an evaluator. If the filter
+// never refers to the item being filtered, isConstant will be true and the
+// evaluator can be called with a nil item. ty is the type of the list or
+// hashmap being filtered, which any function calls are checked against.
+func filterToEvaluator(filter *SelectorFilter, ty Type, params Params) (eval evaluator, isConstant bool, err error) {
+	if err := checkFilter(filter, elementType(ty), params); err != nil {
+		return nil, false, err
+	}
+
+	return conditionToEvaluator(filter.Condition, params)
+}
+
+// evaluatorToPredicate converts an evaluator into a Predicate, which can be
+// passed to an Item's Filter method.
+func evaluatorToPredicate(eval evaluator) Predicate {
+	return func(item Item) (result bool, err error) {
+		val, err := eval(item)
+		if err != nil {
+			return false, err
+		}
+
+		return castBool(val)
+	}
+}
+
+// sliceBounds evaluates the start and end of a slice. If either is omitted, it
+// is nil. Both must be constant, since they don't depend on any one item.
+func sliceBounds(filter *SelectorFilter, params Params) (start, end Item, err error) {
+	if !filter.Condition.isEmpty() {
+		eval, isConstant, err := conditionToEvaluator(filter.Condition, params)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !isConstant {
+			return nil, nil, newError(ErrNOOP, "the start of a slice cannot refer to a field")
+		}
+
+		if start, err = eval(nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if filter.End != nil {
+		eval, isConstant, err := sumToEvaluator(filter.End, params)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !isConstant {
+			return nil, nil, newError(ErrNOOP, "the end of a slice cannot refer to a field")
+		}
+
+		if end, err = eval(nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return start, end, nil
+}
+
+// isEmpty checks whether a condition is empty, like the start of "[:5]".
+func (cond *SelectorCondition) isEmpty() bool {
+	if len(cond.Or) != 1 || len(cond.Or[0].And) != 1 {
+		return false
+	}
+
+	cmp := cond.Or[0].And[0].Comparison
+
+	return cmp != nil && cmp.Left == nil && cmp.Right == nil
+}
+
+// negatedValue checks whether a condition is just a negated value, like
+// "-likes", and if so, returns the value.
+func (cond *SelectorCondition) negatedValue() (val *SelectorValue, ok bool) {
+	if len(cond.Or) != 1 || len(cond.Or[0].And) != 1 {
+		return nil, false
+	}
+
+	cmp := cond.Or[0].And[0].Comparison
+	if cmp == nil || cmp.Left == nil || cmp.Right != nil {
+		return nil, false
+	}
+
+	sum := cmp.Left
+	if len(sum.Right) != 0 || len(sum.Left.Right) != 0 || !sum.Left.Left.Negate {
+		return nil, false
+	}
+
+	return sum.Left.Left.Value, true
+}
+
+func conditionToEvaluator(cond *SelectorCondition, params Params) (eval evaluator, isConstant bool, err error) {
+	if len(cond.Or) == 1 {
+		return conjunctionToEvaluator(cond.Or[0], params)
+	}
+
+	alternatives := make([]evaluator, len(cond.Or))
+	isConstant = true
+
+	for i, conj := range cond.Or {
+		alt, constant, err := conjunctionToEvaluator(conj, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		alternatives[i] = alt
+		isConstant = isConstant && constant
+	}
+
+	return func(item Item) (result Item, err error) {
+		for _, alt := range alternatives {
+			val, err := alt(item)
+			if err != nil {
+				return nil, err
+			}
+
+			ok, err := castBool(val)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				return NewBool(true), nil
+			}
+		}
+
+		return NewBool(false), nil
+	}, isConstant, nil
+}
+
+func conjunctionToEvaluator(conj *SelectorConjunction, params Params) (eval evaluator, isConstant bool, err error) {
+	if len(conj.And) == 1 {
+		return termToEvaluator(conj.And[0], params)
+	}
+
+	terms := make([]evaluator, len(conj.And))
+	isConstant = true
+
+	for i, term := range conj.And {
+		ev, constant, err := termToEvaluator(term, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		terms[i] = ev
+		isConstant = isConstant && constant
+	}
+
+	return func(item Item) (result Item, err error) {
+		for _, term := range terms {
+			val, err := term(item)
+			if err != nil {
+				return nil, err
+			}
+
+			ok, err := castBool(val)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				return NewBool(false), nil
+			}
+		}
+
+		return NewBool(true), nil
+	}, isConstant, nil
+}
+
+func termToEvaluator(term *SelectorTerm, params Params) (eval evaluator, isConstant bool, err error) {
+	if not := term.Not; not != nil {
+		inner, isConstant, err := termToEvaluator(not, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return notEvaluator(inner), isConstant, nil
+	}
+
+	return comparisonToEvaluator(term.Comparison, params)
+}
+
+func comparisonToEvaluator(cmp *SelectorFilterComparison, params Params) (eval evaluator, isConstant bool, err error) {
+	var (
+		left           = evaluator(identity)
+		leftIsConstant = false
+	)
+
+	if cmp.Left != nil {
+		left, leftIsConstant, err = sumToEvaluator(cmp.Left, params)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if cmp.Right == nil {
+		return left, leftIsConstant, nil
+	}
+
+	right, rightIsConstant, err := sumToEvaluator(cmp.Right, params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	isConstant = leftIsConstant && rightIsConstant
+
+	if cmp.Comparison == "in" {
+		return func(item Item) (result Item, err error) {
+			lval, rval, err := evaluateOperands(item, left, right)
+			if err != nil {
+				return nil, err
+			}
+
+			list, ok := rval.(*List)
+			if !ok {
+				return nil, newError(ErrType, "the right hand argument to in must be a list, but got a %s", rval.Type())
+			}
+
+			found, err := listContains(list, lval)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewBool(found), nil
+		}, isConstant, nil
+	}
+
+	comparison, ok := stringToComparison(cmp.Comparison)
+	if !ok {
+		return nil, false, newError(ErrNOOP, "invalid comparison operator: %s", cmp.Comparison)
+	}
+
+	return func(item Item) (result Item, err error) {
+		lval, rval, err := evaluateOperands(item, left, right)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := compareItems(lval, comparison, rval)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBool(ok), nil
+	}, isConstant, nil
+}
+
+// evaluateOperands evaluates both sides of a comparison. If one side refers to
+// a field or key which doesn't exist and the other side is null, the missing
+// side is treated as null too.
+func evaluateOperands(item Item, left, right evaluator) (lval, rval Item, err error) {
+	lval, lerr := left(item)
+	rval, rerr := right(item)
+
+	if _, ok := rval.(*Null); ok && isMissing(lerr) {
+		lval, lerr = NewNull(), nil
+	} else if _, ok := lval.(*Null); ok && isMissing(rerr) {
+		rval, rerr = NewNull(), nil
+	}
+
+	if lerr != nil {
+		return nil, nil, lerr
+	}
+
+	if rerr != nil {
+		return nil, nil, rerr
+	}
+
+	return lval, rval, nil
+}
+
+// compareItems compares two items. If either of them is null, the comparison
+// is done by the null, since other items don't know how to compare themselves
+// with it.
+func compareItems(left Item, kind Comparison, right Item) (result bool, err error) {
+	if _, ok := right.(*Null); ok {
+		return right.Compare(kind, left)
+	}
+
+	return left.Compare(kind, right)
+}
+
+func sumToEvaluator(sum *SelectorSum, params Params) (eval evaluator, isConstant bool, err error) {
+	eval, isConstant, err = productToEvaluator(sum.Left, params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, operand := range sum.Right {
+		right, constant, err := productToEvaluator(operand.Product, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		eval = arithmeticEvaluator(operand.Operator, eval, right)
+		isConstant = isConstant && constant
+	}
+
+	return eval, isConstant, nil
+}
+
+func productToEvaluator(prod *SelectorProduct, params Params) (eval evaluator, isConstant bool, err error) {
+	eval, isConstant, err = unaryToEvaluator(prod.Left, params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, operand := range prod.Right {
+		right, constant, err := unaryToEvaluator(operand.Unary, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		eval = arithmeticEvaluator(operand.Operator, eval, right)
+		isConstant = isConstant && constant
+	}
+
+	return eval, isConstant, nil
+}
+
+func unaryToEvaluator(unary *SelectorUnary, params Params) (eval evaluator, isConstant bool, err error) {
+	eval, isConstant, err = valueToEvaluator(unary.Value, params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if unary.Negate {
+		eval = arithmeticEvaluator("-", constantEvaluator(NewInt(0)), eval)
+	} else if unary.Not {
+		eval = notEvaluator(eval)
+	}
+
+	return eval, isConstant, nil
+}
+
+// notEvaluator makes an evaluator which negates the result of inner, which
+// must be a bool.
+func notEvaluator(inner evaluator) evaluator {
+	return func(item Item) (result Item, err error) {
+		val, err := inner(item)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := castBool(val)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBool(!ok), nil
+	}
+}
+
+func valueToEvaluator(val *SelectorValue, params Params) (eval evaluator, isConstant bool, err error) {
+	if lit := val.Literal; lit != nil {
+		return constantEvaluator(selectorLiteralToItem(lit)), true, nil
+	} else if fn := val.Function; fn != nil {
+		return functionToEvaluator(fn, params)
+	} else if field := val.Field; field != nil {
+		return func(item Item) (result Item, err error) {
+			return item.GetField(*field)
+		}, false, nil
+	} else if name := val.Variable; name != nil {
+		v, err := params.lookup(strings.TrimPrefix(*name, "$"))
+		if err != nil {
+			return nil, false, err
+		}
+
+		return constantEvaluator(v), true, nil
+	}
+
+	return conditionToEvaluator(val.Group, params)
+}
+
+func identity(item Item) (result Item, err error) {
+	return item, nil
+}
+
+func constantEvaluator(val Item) evaluator {
+	return func(item Item) (result Item, err error) {
+		return val, nil
+	}
+}
+
+// arithmeticEvaluator makes an evaluator which applies an arithmetic operator
+// to the results of two other evaluators, using arithmetic.
+func arithmeticEvaluator(operator string, left, right evaluator) evaluator {
+	return func(item Item) (result Item, err error) {
+		lval, err := left(item)
+		if err != nil {
+			return nil, err
+		}
+
+		rval, err := right(item)
+		if err != nil {
+			return nil, err
+		}
+
+		return arithmetic(operator, lval, rval)
+	}
+}
+
+// arithmetic applies an arithmetic operator to two numbers. If both of them
+// are integers, the arithmetic is exact, otherwise they're cast to float64 and
+// the result is a Float.
+func arithmetic(operator string, lval, rval Item) (result Item, err error) {
+	if isInteger(lval) && isInteger(rval) {
+		return integerArithmetic(operator, lval, rval)
+	}
+
+	l, lok := castNumeric(lval)
+	r, rok := castNumeric(rval)
+	if !lok || !rok {
+		return nil, newError(ErrType, "cannot apply %s to %s and %s", operator, lval.Type(), rval.Type())
+	}
+
+	switch operator {
+	case "+":
+		return NewFloat(l + r), nil
+
+	case "-":
+		return NewFloat(l - r), nil
+
+	case "*":
+		return NewFloat(l * r), nil
+
+	case "/":
+		if r == 0 {
+			return nil, newError(ErrNOOP, "division by zero")
+		}
+
+		return NewFloat(l / r), nil
+
+	case "%":
+		if r == 0 {
+			return nil, newError(ErrNOOP, "division by zero")
+		}
+
+		return NewFloat(math.Mod(l, r)), nil
+
+	default:
+		return nil, newError(ErrNOOP, "invalid arithmetic operator: %s", operator)
+	}
+}
+
+func castBool(item Item) (val bool, err error) {
+	b, ok := item.(*Bool)
+	if !ok {
+		return false, newError(ErrType, "expected a boolean condition, but got a %s", item.Type())
+	}
+
+	return b.value, nil
+}
@@ -35,9 +35,9 @@ func (f *Float) JSON() string {
 
 // Set sets the value of the item to the given value
 func (f *Float) Set(val interface{}) (err error) {
-	fval, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected a float value")
+	fval, err := parseFloat(val, 64, f.Type())
+	if err != nil {
+		return err
 	}
 
 	f.value = fval
@@ -47,29 +47,29 @@ func (f *Float) Set(val interface{}) (err error) {
 
 // Compare compares two items
 func (f *Float) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(f, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare floats with numeric types (ints, floats, uints, ...)")
 	}
 
 	switch kind {
 	case Equal:
-		return f.value == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return f.value != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return f.value < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return f.value > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return f.value <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return f.value >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on floats")
@@ -108,9 +108,9 @@ func (f *Float32) JSON() string {
 
 // Set sets the value of the item to the given value
 func (f *Float32) Set(val interface{}) (err error) {
-	fval, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected a float value")
+	fval, err := parseFloat(val, 32, f.Type())
+	if err != nil {
+		return err
 	}
 
 	f.value = float32(fval)
@@ -120,31 +120,29 @@ func (f *Float32) Set(val interface{}) (err error) {
 
 // Compare compares two items
 func (f *Float32) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(f, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare floats with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(f)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on floats")
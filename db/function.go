@@ -0,0 +1,262 @@
+package db
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A function can be called in a filter, like "len(friends)". It's given the
+// evaluators for its arguments, rather than their values, so that it can
+// decide how to handle errors, and the item being filtered.
+type function func(item Item, args []evaluator) (result Item, err error)
+
+// A functionDef is a function, along with the types of its arguments and its
+// result, which are used to check calls against the schema before any elements
+// are filtered. A nil result type means that it isn't known.
+type functionDef struct {
+	fn     function
+	args   []argType
+	result Type
+}
+
+// An argType says which types a function's argument can have.
+type argType struct {
+	name    string
+	accepts func(ty Type) bool
+}
+
+var (
+	stringArg = argType{"a string", func(ty Type) bool {
+		_, ok := ty.(*StringType)
+		return ok
+	}}
+
+	lengthArg = argType{"a string, list or hashmap", func(ty Type) bool {
+		switch ty.(type) {
+		case *StringType, *ListType, *HashmapType:
+			return true
+		}
+
+		return false
+	}}
+
+	stringOrListArg = argType{"a string or list", func(ty Type) bool {
+		switch ty.(type) {
+		case *StringType, *ListType:
+			return true
+		}
+
+		return false
+	}}
+
+	anyArg = argType{"anything", func(ty Type) bool {
+		return true
+	}}
+)
+
+var functions map[string]functionDef
+
+func init() {
+	functions = map[string]functionDef{
+		"len":        {lenFunction, []argType{lengthArg}, &IntType{}},
+		"lower":      {stringFunction(strings.ToLower), []argType{stringArg}, &StringType{}},
+		"upper":      {stringFunction(strings.ToUpper), []argType{stringArg}, &StringType{}},
+		"contains":   {containsFunction, []argType{stringOrListArg, anyArg}, &BoolType{}},
+		"startswith": {stringPredicate(strings.HasPrefix), []argType{stringArg, stringArg}, &BoolType{}},
+		"has":        {hasFunction, []argType{anyArg}, &BoolType{}},
+	}
+}
+
+// functionToEvaluator makes an evaluator which calls a function. It's constant
+// if all of the arguments are.
+func functionToEvaluator(call *SelectorFunction, params Params) (eval evaluator, isConstant bool, err error) {
+	def, ok := functions[call.Name]
+	if !ok {
+		return nil, false, newError(ErrNOOP, "undefined function %s", call.Name)
+	}
+
+	// an empty argument list is parsed as a single empty condition
+	argConds := call.Args
+	if len(argConds) == 1 && argConds[0].isEmpty() {
+		argConds = nil
+	}
+
+	if len(argConds) != len(def.args) {
+		return nil, false, newError(ErrNOOP, "%s takes %d argument(s), but got %d", call.Name, len(def.args), len(argConds))
+	}
+
+	args := make([]evaluator, len(argConds))
+	isConstant = true
+
+	for i, arg := range argConds {
+		ev, constant, err := conditionToEvaluator(arg, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		args[i] = ev
+		isConstant = isConstant && constant
+	}
+
+	return func(item Item) (result Item, err error) {
+		return def.fn(item, args)
+	}, isConstant, nil
+}
+
+// evaluateArgs evaluates each argument of a function.
+func evaluateArgs(item Item, args []evaluator) (vals []Item, err error) {
+	vals = make([]Item, len(args))
+
+	for i, arg := range args {
+		if vals[i], err = arg(item); err != nil {
+			return nil, err
+		}
+	}
+
+	return vals, nil
+}
+
+func castString(item Item) (val string, err error) {
+	s, ok := item.(*String)
+	if !ok {
+		return "", newError(ErrType, "expected a string, but got a %s", item.Type())
+	}
+
+	return s.value, nil
+}
+
+// lenFunction returns the number of characters in a string, or the number of
+// elements in a list or hashmap.
+func lenFunction(item Item, args []evaluator) (result Item, err error) {
+	val, err := args[0](item)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := val.(type) {
+	case *String:
+		return NewInt(int64(utf8.RuneCountInString(v.value))), nil
+
+	case *List:
+		return NewInt(int64(len(v.value))), nil
+
+	case *Hashmap:
+		return NewInt(int64(len(v.data))), nil
+	}
+
+	return nil, newError(ErrType, "len expects a string, list or hashmap, but got a %s", val.Type())
+}
+
+// stringFunction makes a function which transforms a string.
+func stringFunction(fn func(string) string) function {
+	return func(item Item, args []evaluator) (result Item, err error) {
+		val, err := args[0](item)
+		if err != nil {
+			return nil, err
+		}
+
+		str, err := castString(val)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewString(fn(str)), nil
+	}
+}
+
+// stringPredicate makes a function which checks something about two strings.
+func stringPredicate(fn func(s, arg string) bool) function {
+	return func(item Item, args []evaluator) (result Item, err error) {
+		vals, err := evaluateArgs(item, args)
+		if err != nil {
+			return nil, err
+		}
+
+		str, err := castString(vals[0])
+		if err != nil {
+			return nil, err
+		}
+
+		arg, err := castString(vals[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBool(fn(str, arg)), nil
+	}
+}
+
+// containsFunction checks whether a string contains a substring, or whether a
+// list contains an element equal to a value.
+func containsFunction(item Item, args []evaluator) (result Item, err error) {
+	vals, err := evaluateArgs(item, args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch col := vals[0].(type) {
+	case *String:
+		sub, err := castString(vals[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBool(strings.Contains(col.value, sub)), nil
+
+	case *List:
+		found, err := listContains(col, vals[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBool(found), nil
+	}
+
+	return nil, newError(ErrType, "contains expects a string or list, but got a %s", vals[0].Type())
+}
+
+// listContains checks whether a list has an element equal to a value.
+func listContains(list *List, val Item) (found bool, err error) {
+	for _, elem := range list.value {
+		eq, err := compareItems(elem, Equal, val)
+		if err != nil {
+			return false, err
+		}
+
+		if eq {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// hasFunction checks whether a field or key exists and isn't empty. Empty
+// strings, lists and hashmaps count as missing, since every field of a struct
+// always exists.
+func hasFunction(item Item, args []evaluator) (result Item, err error) {
+	val, err := args[0](item)
+	if err != nil {
+		if isMissing(err) {
+			return NewBool(false), nil
+		}
+
+		return nil, err
+	}
+
+	switch v := val.(type) {
+	case *Null:
+		return NewBool(false), nil
+
+	case *String:
+		return NewBool(v.value != ""), nil
+
+	case *List:
+		return NewBool(len(v.value) > 0), nil
+
+	case *Hashmap:
+		return NewBool(len(v.data) > 0), nil
+	}
+
+	return NewBool(true), nil
+}
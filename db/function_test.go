@@ -0,0 +1,69 @@
+package db
+
+import "testing"
+
+const functionTestSchema = `
+users: [user]
+byname: <string:user>
+
+struct user {
+    name: string
+    age: int
+    friends: [string]
+}`
+
+// TestFunctionTypes checks that the arguments of functions are checked against
+// the schema, even when there are no elements to filter.
+func TestFunctionTypes(t *testing.T) {
+	d, err := OpenString(functionTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []string{
+		"users[lower(age) = 'a']",
+		"users[upper(friends) = 'A']",
+		"users[len(age) > 1]",
+		"users[startswith(name, 1)]",
+		"users[startswith(age, 'a')]",
+		"users[contains(age, 1)]",
+		"users[len(lower(age)) > 1]",
+		"users[lower(len(name)) = '1']",
+		"users[!startswith(age, 'a')]",
+		"byname[lower(age) = 'a']",
+		"users[startswith(name, $n)]",
+	}
+
+	params := Params{"n": NewInt(1)}
+
+	for _, sel := range invalid {
+		res, err := d.QueryStringWithParams(sel, params)
+		if err == nil {
+			t.Errorf("%s: expected an error, but got %s", sel, res.JSON())
+		}
+	}
+
+	valid := []string{
+		"users[lower(name) = 'a']",
+		"users[len(friends) > 1]",
+		"users[len(name) > 1]",
+		"users[contains(friends, 'a')]",
+		"users[contains(name, 'a')]",
+		"users[startswith(lower(name), 'a')]",
+		"users[has(email)]",
+		"users[has(age)]",
+		"byname[upper(name) = 'A']",
+		"users[startswith(name, $n)]",
+	}
+
+	params = Params{"n": NewString("A")}
+
+	for _, sel := range valid {
+		res, err := d.QueryStringWithParams(sel, params)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+		} else if got := res.JSON(); got != "[]" && got != "{}" {
+			t.Errorf("%s: got %s, want an empty result", sel, got)
+		}
+	}
+}
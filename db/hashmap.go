@@ -1,9 +1,9 @@
 package db
 
 import (
+	"encoding/json"
+	"sort"
 	"strings"
-
-	"github.com/cnf/structhash"
 )
 
 // A Hashmap maps keys to values and enables O(1) lookup complexity.
@@ -68,29 +68,43 @@ func (h *Hashmap) String() string {
 	return str.String()
 }
 
-// JSON returns a JSON representation of an item
+// JSON returns a JSON representation of an item. The keys are ordered by
+// their JSON representations, so the same hashmap always has the same
+// representation.
 func (h *Hashmap) JSON() string {
+	keys := make([]string, 0, len(h.data))
+	hashes := make(map[string]string, len(h.data))
+
+	for hash := range h.data {
+		key := h.keys[hash]
+
+		// JSON objects can only have string keys, so other keys are
+		// encoded as JSON and then stored in a string.
+		var enc string
+		if key.Type().Equals(&StringType{}) {
+			enc = key.JSON()
+		} else {
+			enc = quoteJSON(key.JSON())
+		}
+
+		keys = append(keys, enc)
+		hashes[enc] = hash
+	}
+
+	sort.Strings(keys)
+
 	str := &strings.Builder{}
 
 	str.WriteByte('{')
 
-	i := 0
-	for hash, val := range h.data {
-		key := h.keys[hash]
+	for i, key := range keys {
 		if i > 0 {
 			str.WriteString(", ")
 		}
 
-		if key.Type().Equals(&StringType{}) {
-			str.WriteString(key.JSON())
-		} else {
-			str.WriteString("\"" + key.String() + "\"")
-		}
-
+		str.WriteString(key)
 		str.WriteString(": ")
-		str.WriteString(val.JSON())
-
-		i++
+		str.WriteString(h.data[hashes[key]].JSON())
 	}
 
 	str.WriteByte('}')
@@ -98,36 +112,54 @@ func (h *Hashmap) JSON() string {
 	return str.String()
 }
 
-// Set sets the value of the item to the given value
+// Set sets the value of the item to the given value. Since JSON objects can
+// only have string keys, the keys of hashmaps whose key type isn't string are
+// expected to be JSON encoded, as they are by Hashmap.JSON.
 func (h *Hashmap) Set(val interface{}) (err error) {
-	if !h.keyType.Equals(&StringType{}) {
-		return newError(ErrNOOP, "set can only be used on <string:any> hashmaps, due to JSON syntax")
-	}
-
 	hval, ok := val.(map[string]interface{})
 	if !ok {
 		return newError(ErrType, "expected a hashmap value")
 	}
 
-	h.data = make(map[string]Item, len(hval))
-	h.keys = make(map[string]Item, len(hval))
+	var (
+		data = make(map[string]Item, len(hval))
+		keys = make(map[string]Item, len(hval))
+	)
 
 	for k, v := range hval {
-		newVal := MakeZeroValue(h.valType)
-		if err := newVal.Set(v); err != nil {
+		var keyVal interface{} = k
+
+		if !h.keyType.Equals(&StringType{}) {
+			if err := DecodeJSON([]byte(k), &keyVal); err != nil {
+				return newError(ErrType, "expected a JSON encoded %s key, but got %s", h.keyType, k)
+			}
+		}
+
+		key := MakeZeroValue(h.keyType)
+		if err := key.Set(keyVal); err != nil {
 			return err
 		}
 
-		if err := h.SetKey(&String{value: k}, newVal); err != nil {
+		newVal := MakeZeroValue(h.valType)
+		if err := newVal.Set(v); err != nil {
 			return err
 		}
+
+		hash := hashKey(key)
+		data[hash] = newVal
+		keys[hash] = key
 	}
 
+	h.data = data
+	h.keys = keys
+
 	return nil
 }
 
 // GetKey gets the given key from the hashmap
 func (h *Hashmap) GetKey(key Item) (result Item, err error) {
+	key = coerceKey(key, h.keyType)
+
 	if !key.Type().Equals(h.keyType) {
 		return nil, newError(
 			ErrType, "hashmap key type is %s, but a key of type %s was requested",
@@ -136,12 +168,7 @@ func (h *Hashmap) GetKey(key Item) (result Item, err error) {
 		)
 	}
 
-	hash, err := structhash.Hash(key, 1)
-	if err != nil {
-		return nil, newError(ErrUnknown, "could not hash a value for some reason")
-	}
-
-	val, ok := h.data[hash]
+	val, ok := h.data[hashKey(key)]
 	if !ok {
 		return nil, newError(ErrIndex, "key %s does not exist", key)
 	}
@@ -167,11 +194,7 @@ func (h *Hashmap) SetKey(key Item, to Item) (err error) {
 		)
 	}
 
-	hash, err := structhash.Hash(key, 1)
-	if err != nil {
-		return newError(ErrIndex, "key %s does not exist", key)
-	}
-
+	hash := hashKey(key)
 	h.data[hash] = to
 	h.keys[hash] = key
 
@@ -199,11 +222,9 @@ func (h *Hashmap) SetKeyJSON(keyJSON interface{}, toJSON interface{}) (err error
 
 // UnsetKey removes the given key.
 func (h *Hashmap) UnsetKey(key Item) (err error) {
-	hash, err := structhash.Hash(key, 1)
-	if err != nil {
-		return newError(ErrIndex, "key %s cannot be hashed", key)
-	}
+	key = coerceKey(key, h.keyType)
 
+	hash := hashKey(key)
 	if _, ok := h.keys[hash]; !ok {
 		return newError(ErrIndex, "key %s does not exist", key)
 	}
@@ -225,9 +246,20 @@ func (h *Hashmap) UnsetKeyJSON(keyJSON interface{}) (err error) {
 	return h.UnsetKey(key)
 }
 
-// GetField gets the given field from the hashmap
+// GetField gets the given field from the hashmap, if its keys are strings.
+// Otherwise, the field is taken from each of its values in the same way as
+// List.GetField, e.g. "posts_by_id.title" is a list of every post's title.
 func (h *Hashmap) GetField(key string) (result Item, err error) {
-	return h.GetKey(NewString(key))
+	if _, ok := h.keyType.(*StringType); ok {
+		return h.GetKey(NewString(key))
+	}
+
+	vals, _, err := elements(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapField(vals, h.valType, key)
 }
 
 // SetField sets the given field in the hashmap to a value
@@ -237,7 +269,7 @@ func (h *Hashmap) SetField(key string, to Item) (err error) {
 
 // Filter filters the hashmap, returning a new hashmap where only the
 // filtered key:val pairs are present.
-func (h *Hashmap) Filter(field string, kind Comparison, other Item) (result Item, err error) {
+func (h *Hashmap) Filter(pred Predicate) (result Item, err error) {
 	result = &Hashmap{
 		keyType: h.keyType,
 		valType: h.valType,
@@ -246,38 +278,67 @@ func (h *Hashmap) Filter(field string, kind Comparison, other Item) (result Item
 	}
 
 	for hash, val := range h.data {
-		var (
-			key       = h.keys[hash]
-			predicate bool
-		)
+		predicate, err := pred(val)
+		if err != nil {
+			return nil, err
+		}
 
-		if field == "" {
-			pred, err := val.Compare(kind, other)
-			if err != nil {
-				return nil, err
-			}
+		if predicate {
+			result.SetKey(h.keys[hash], val)
+		}
+	}
 
-			predicate = pred
-		} else {
-			fval, err := val.GetField(field)
-			if err != nil {
-				return nil, err
-			}
+	return result, nil
+}
 
-			pred, err := fval.Compare(kind, other)
-			if err != nil {
-				return nil, err
-			}
+// Delete removes every key:val pair whose value passes through the filter,
+// returning how many were removed. If the filter fails, h isn't changed.
+func (h *Hashmap) Delete(pred Predicate) (removed int, err error) {
+	var hashes []string
 
-			predicate = pred
+	for hash, val := range h.data {
+		predicate, err := pred(val)
+		if err != nil {
+			return 0, err
 		}
 
 		if predicate {
-			result.SetKey(key, val)
+			hashes = append(hashes, hash)
 		}
 	}
 
-	return result, nil
+	for _, hash := range hashes {
+		delete(h.keys, hash)
+		delete(h.data, hash)
+	}
+
+	return len(hashes), nil
+}
+
+// Project returns a new hashmap with the same keys as h, made by projecting
+// each of its values.
+func (h *Hashmap) Project(fields []string) (result Item, err error) {
+	valType, err := projectType(h.valType, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	hashmap := &Hashmap{
+		keyType: h.keyType,
+		valType: valType,
+		data:    make(map[string]Item, len(h.data)),
+		keys:    make(map[string]Item, len(h.keys)),
+	}
+
+	for hash, val := range h.data {
+		if hashmap.data[hash], err = val.Project(fields); err != nil {
+			return nil, err
+		}
+
+		hashmap.keys[hash] = h.keys[hash]
+	}
+
+	return hashmap, nil
 }
 
 // Empty clears the data of the hashmap.
@@ -287,3 +348,30 @@ func (h *Hashmap) Empty() (err error) {
 
 	return nil
 }
+
+// coerceKey converts a numeric key to the hashmap's key type, if it's numeric
+// too and can hold the key's value. Number literals in selectors are always
+// floats, so otherwise "scores[3]" wouldn't work on an <int:int>.
+func coerceKey(key Item, keyType Type) Item {
+	if !isNumber(key) || key.Type().Equals(keyType) {
+		return key
+	}
+
+	coerced := MakeZeroValue(keyType)
+	if coerced == nil || !isNumber(coerced) {
+		return key
+	}
+
+	if err := coerced.Set(json.Number(key.String())); err != nil {
+		return key
+	}
+
+	return coerced
+}
+
+// hashKey returns the string which a key is stored under in a hashmap. This is
+// the key's JSON representation, which is the same for any two equal keys,
+// even structs and hashmaps, since their fields and keys are sorted.
+func hashKey(key Item) string {
+	return key.JSON()
+}
@@ -32,43 +32,41 @@ func (i *Int) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Int) Set(val interface{}) (err error) {
-	ival, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = int64(ival)
+	i.value = int64(ival.Int64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Int) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare ints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on ints")
@@ -107,43 +105,41 @@ func (i *Int32) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Int32) Set(val interface{}) (err error) {
-	ival, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = int32(ival)
+	i.value = int32(ival.Int64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Int32) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare ints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on ints")
@@ -182,43 +178,41 @@ func (i *Int16) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Int16) Set(val interface{}) (err error) {
-	ival, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = int16(ival)
+	i.value = int16(ival.Int64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Int16) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare ints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on ints")
@@ -257,43 +251,41 @@ func (i *Int8) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Int8) Set(val interface{}) (err error) {
-	ival, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = int8(ival)
+	i.value = int8(ival.Int64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Int8) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare ints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on ints")
@@ -37,6 +37,10 @@ func stringToComparison(str string) (cmp Comparison, ok bool) {
 	return -1, false
 }
 
+// A Predicate decides whether an item should be kept when filtering a
+// collection.
+type Predicate func(item Item) (result bool, err error)
+
 // ErrorType says what the cause of an error is
 type ErrorType string
 
@@ -75,7 +79,10 @@ type Item interface {
 	UnsetKeyJSON(key interface{}) (err error)
 	SetField(key string, to Item) (err error)
 	Compare(kind Comparison, other Item) (result bool, err error)
-	Filter(field string, kind Comparison, other Item) (result Item, err error)
+	Filter(pred Predicate) (result Item, err error)
+	Delete(pred Predicate) (removed int, err error)
+	Project(fields []string) (result Item, err error)
+	Slice(start, end Item) (result Item, err error)
 	Append(items ...Item) (err error)
 	AppendJSON(json interface{}) (err error)
 	Prepend(items ...Item) (err error)
@@ -113,10 +120,22 @@ func (i *itemDefaults) Compare(kind Comparison, other Item) (result bool, err er
 	return false, newError(ErrNOOP, "compare not supported")
 }
 
-func (i *itemDefaults) Filter(field string, kind Comparison, other Item) (result Item, err error) {
+func (i *itemDefaults) Filter(pred Predicate) (result Item, err error) {
 	return nil, newError(ErrNOOP, "filter not supported")
 }
 
+func (i *itemDefaults) Delete(pred Predicate) (removed int, err error) {
+	return 0, newError(ErrNOOP, "delete not supported")
+}
+
+func (i *itemDefaults) Project(fields []string) (result Item, err error) {
+	return nil, newError(ErrNOOP, "project not supported")
+}
+
+func (i *itemDefaults) Slice(start, end Item) (result Item, err error) {
+	return nil, newError(ErrNOOP, "slice not supported")
+}
+
 func (i *itemDefaults) Append(items ...Item) (err error) {
 	return newError(ErrNOOP, "append not supported")
 }
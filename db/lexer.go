@@ -0,0 +1,163 @@
+package db
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// selectorLexer lexes selectors. It works in the same way as lexer.Regexp,
+// except that a "/" only starts a regexp where an operand is expected, so
+// "likes/2 > likes/3" is two divisions rather than containing the regexp
+// "/2 > likes/".
+var selectorLexer = newSelectorDefinition(`(?m)(\s+)` +
+	`|(?P<Call>[\p{L}\p{M}_](?:[\p{L}\p{M}\d_]|-\p{L})*\()` +
+	`|(?P<Ident>[\p{L}\p{M}_](?:[\p{L}\p{M}\d_]|-\p{L})*)` +
+	`|(?P<Variable>\$[\p{L}\p{M}_][\p{L}\p{M}\d_]*)` +
+	`|(?P<Number>\d+(?:\.\d+)?(?:[eE][+\-]?\d+)?)` +
+	`|(?P<String>"(?:\\.|[^"])*"|'(?:\\.|[^'])*')` +
+	`|(?P<Regexp>/(?:\\.|[^/\s])(?:\\.|[^/])*/)` +
+	`|(?P<Comparison>(?:=|!=|>=?|<=?|~))` +
+	`|(?P<Punctuation>->|\.\.|[\.\[\]()&|!+\-*/%{},:])`,
+)
+
+var selectorSymbols = selectorLexer.Symbols()
+
+var eolBytes = []byte("\n")
+
+type selectorDefinition struct {
+	re      *regexp.Regexp
+	symbols map[string]rune
+}
+
+func newSelectorDefinition(pattern string) *selectorDefinition {
+	re := regexp.MustCompile(pattern)
+	symbols := map[string]rune{
+		"EOF": lexer.EOF,
+	}
+
+	for i, sym := range re.SubexpNames()[1:] {
+		if sym != "" {
+			symbols[sym] = lexer.EOF - 1 - rune(i)
+		}
+	}
+
+	return &selectorDefinition{re: re, symbols: symbols}
+}
+
+func (d *selectorDefinition) Lex(r io.Reader) lexer.Lexer {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		panic(err)
+	}
+
+	return &selectorTokens{
+		pos: lexer.Position{
+			Filename: lexer.NameOfReader(r),
+			Line:     1,
+			Column:   1,
+		},
+		b:       b,
+		def:     d,
+		operand: true,
+	}
+}
+
+func (d *selectorDefinition) Symbols() map[string]rune {
+	return d.symbols
+}
+
+// selectorTokens is the lexer for a single selector. operand is true when
+// the next token should be an operand, i.e. at the start of the selector or
+// after an operator or an opening bracket.
+type selectorTokens struct {
+	pos     lexer.Position
+	b       []byte
+	def     *selectorDefinition
+	operand bool
+}
+
+func (l *selectorTokens) Next() lexer.Token {
+	names := l.def.re.SubexpNames()
+
+	for len(l.b) != 0 {
+		matches := l.def.re.FindSubmatchIndex(l.b)
+		if matches == nil || matches[0] != 0 {
+			rn, _ := utf8.DecodeRune(l.b)
+			lexer.Panicf(l.pos, "invalid token %q", rn)
+		}
+
+		group := 0
+		for i := 2; i < len(matches); i += 2 {
+			if matches[i] != -1 {
+				group = i / 2
+				break
+			}
+		}
+
+		end := matches[1]
+		token := lexer.Token{
+			Type: lexer.EOF - rune(group),
+			Pos:  l.pos,
+		}
+
+		// Where an operator is expected, a "/" is a division, even if the
+		// rest of the selector looks like a regexp.
+		if token.Type == l.def.symbols["Regexp"] && !l.operand {
+			end = 1
+			token.Type = l.def.symbols["Punctuation"]
+		}
+
+		token.Value = string(l.b[:end])
+		l.advance(end)
+
+		if names[group] == "" {
+			continue
+		}
+
+		l.operand = expectsOperand(token, l.def.symbols)
+		return token
+	}
+
+	return lexer.EOFToken(l.pos)
+}
+
+func (l *selectorTokens) advance(n int) {
+	match := l.b[:n]
+
+	l.pos.Offset += n
+	lines := bytes.Count(match, eolBytes)
+	l.pos.Line += lines
+
+	if lines == 0 {
+		l.pos.Column += utf8.RuneCount(match)
+	} else {
+		l.pos.Column = utf8.RuneCount(match[bytes.LastIndex(match, eolBytes):])
+	}
+
+	l.b = l.b[n:]
+}
+
+// expectsOperand returns whether an operand can follow the given token. Only
+// values, and brackets which close them, can be followed by an operator.
+func expectsOperand(token lexer.Token, symbols map[string]rune) bool {
+	switch token.Type {
+	case symbols["Ident"]:
+		return token.Value == "in"
+
+	case symbols["Variable"], symbols["Number"], symbols["String"], symbols["Regexp"]:
+		return false
+
+	case symbols["Punctuation"]:
+		switch token.Value {
+		case ")", "]", "}":
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/json"
 	"strings"
 )
 
@@ -93,16 +94,11 @@ func (l *List) Set(val interface{}) (err error) {
 }
 
 // GetKey returns the item at the given key, provided the key is an integer.
+// Negative keys count backwards from the end of the list.
 func (l *List) GetKey(key Item) (result Item, err error) {
-	val, ok := castNumeric(key)
-	if !ok {
-		return nil, newError(ErrType, "can only index a list with a numeric type")
-	}
-
-	index := int(val)
-
-	if index < 0 || index >= len(l.value) {
-		return nil, newError(ErrIndex, "index out of bounds")
+	index, err := l.index(key)
+	if err != nil {
+		return nil, err
 	}
 
 	return l.value[index], nil
@@ -111,59 +107,171 @@ func (l *List) GetKey(key Item) (result Item, err error) {
 // SetKey sets the item at the given key to something, provided the key is
 // an integer.
 func (l *List) SetKey(key Item, to Item) (err error) {
-	val, ok := castNumeric(key)
-	if !ok {
-		return newError(ErrType, "can only index a list with a numeric type")
+	index, err := l.index(key)
+	if err != nil {
+		return err
+	}
+
+	l.value[index] = to
+	return nil
+}
+
+// GetField gets the given field of every member of the list, returning a new
+// list of the results. If the field of a member is itself a list, its members
+// are added to the result instead, so "users.friends" is a list of all of the
+// users' friends, rather than a list of lists.
+func (l *List) GetField(key string) (result Item, err error) {
+	return mapField(l.value, l.valType, key)
+}
+
+// index converts a key into an index of the list. Negative keys count
+// backwards from the end, so -1 is the last element.
+func (l *List) index(key Item) (index int, err error) {
+	i, err := listIndex(key, "index")
+	if err != nil {
+		return 0, err
 	}
 
-	index := int(val)
+	if i < 0 {
+		i += int64(len(l.value))
+	}
 
-	if index < 0 || index >= len(l.value) {
-		return newError(ErrIndex, "index out of bounds")
+	if i < 0 || i >= int64(len(l.value)) {
+		return 0, newError(ErrIndex, "index out of bounds")
 	}
 
-	l.value[index] = to
-	return nil
+	return int(i), nil
+}
+
+// listIndex converts a key into an index, checking that it's a whole number,
+// so that e.g. "users[1.5]" is an error rather than being rounded down. The
+// verb is what the key is being used for, e.g. "index" or "slice".
+func listIndex(key Item, verb string) (index int64, err error) {
+	if !isNumber(key) {
+		return 0, newError(ErrType, "can only %s a list with a numeric type", verb)
+	}
+
+	i, err := parseInteger(json.Number(key.String()), &IntType{})
+	if err != nil {
+		return 0, newError(ErrType, "can only %s a list with an integer, but got %s", verb, key)
+	}
+
+	return i.Int64(), nil
+}
+
+// Slice returns a new list containing the elements of l from start up to, but
+// not including, end. If start or end is nil, the slice goes from the start or
+// to the end of the list. Negative indexes count backwards from the end, and
+// indexes past either end of the list are clamped to it.
+func (l *List) Slice(start, end Item) (result Item, err error) {
+	from, err := l.sliceBound(start, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := l.sliceBound(end, len(l.value))
+	if err != nil {
+		return nil, err
+	}
+
+	if to < from {
+		to = from
+	}
+
+	// the elements are copied into a new slice, so that modifying the result
+	// doesn't affect l
+	return &List{
+		valType: l.valType,
+		value:   append([]Item(nil), l.value[from:to]...),
+	}, nil
+}
+
+func (l *List) sliceBound(key Item, def int) (index int, err error) {
+	if key == nil {
+		return def, nil
+	}
+
+	i, err := listIndex(key, "slice")
+	if err != nil {
+		return 0, err
+	}
+
+	if i < 0 {
+		i += int64(len(l.value))
+	}
+
+	if i < 0 {
+		return 0, nil
+	} else if i > int64(len(l.value)) {
+		return len(l.value), nil
+	}
+
+	return int(i), nil
 }
 
 // Filter returns a new list with all members of l which pass through the
 // filter.
-func (l *List) Filter(field string, kind Comparison, other Item) (result Item, err error) {
+func (l *List) Filter(pred Predicate) (result Item, err error) {
 	result = &List{
 		valType: l.valType,
 		value:   make([]Item, 0, len(l.value)/2), // initialise with capacity as len()/2
 	}
 
 	for _, i := range l.value {
-		var predicate bool
+		predicate, err := pred(i)
+		if err != nil {
+			return nil, err
+		}
 
-		if field == "" {
-			pred, err := i.Compare(kind, other)
-			if err != nil {
-				return nil, err
-			}
+		if predicate {
+			result.Append(i)
+		}
+	}
 
-			predicate = pred
-		} else {
-			val, err := i.GetField(field)
-			if err != nil {
-				return nil, err
-			}
+	return result, nil
+}
 
-			pred, err := val.Compare(kind, other)
-			if err != nil {
-				return nil, err
-			}
+// Delete removes every member of l which passes through the filter, returning
+// how many were removed. If the filter fails, l isn't changed.
+func (l *List) Delete(pred Predicate) (removed int, err error) {
+	kept := make([]Item, 0, len(l.value))
 
-			predicate = pred
+	for _, i := range l.value {
+		predicate, err := pred(i)
+		if err != nil {
+			return 0, err
 		}
 
-		if predicate {
-			result.Append(i)
+		if !predicate {
+			kept = append(kept, i)
 		}
 	}
 
-	return result, nil
+	removed = len(l.value) - len(kept)
+	l.value = kept
+
+	return removed, nil
+}
+
+// Project returns a new list, made by projecting each member of l.
+func (l *List) Project(fields []string) (result Item, err error) {
+	valType, err := projectType(l.valType, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &List{
+		valType: valType,
+		value:   make([]Item, len(l.value)),
+	}
+
+	for i, item := range l.value {
+		if list.value[i], err = item.Project(fields); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
 }
 
 // Append appends an item to the list.
@@ -203,15 +311,9 @@ func (l *List) PrependJSON(json interface{}) (err error) {
 
 // UnsetKey removes the element at the given index.
 func (l *List) UnsetKey(key Item) (err error) {
-	val, ok := castNumeric(key)
-	if !ok {
-		return newError(ErrType, "can only index a list with a numeric type")
-	}
-
-	index := int(val)
-
-	if index < 0 || index >= len(l.value) {
-		return newError(ErrIndex, "index out of bounds")
+	index, err := l.index(key)
+	if err != nil {
+		return err
 	}
 
 	l.value = append(l.value[:index], l.value[index+1:]...)
@@ -235,3 +337,38 @@ func (l *List) Empty() (err error) {
 	l.value = make([]Item, 0)
 	return nil
 }
+
+// mapField gets a field of each of the items, which are of type ty, flattening
+// any lists into the result.
+func mapField(items []Item, ty Type, key string) (result Item, err error) {
+	elemType, err := fieldType(ty, key)
+	if err != nil {
+		return nil, err
+	}
+
+	flatten := false
+	if list, ok := elemType.(*ListType); ok {
+		elemType = list.ElemType
+		flatten = true
+	}
+
+	mapped := &List{
+		valType: elemType,
+		value:   make([]Item, 0, len(items)),
+	}
+
+	for _, item := range items {
+		val, err := item.GetField(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if list, ok := val.(*List); ok && flatten {
+			mapped.value = append(mapped.value, list.value...)
+		} else {
+			mapped.value = append(mapped.value, val)
+		}
+	}
+
+	return mapped, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import "sort"
+
+// lockFields acquires the locks needed to query, or modify if write is true,
+// the given top-level fields. The returned function releases them again.
+//
+// The locks are always acquired in order of the fields' names, so that two
+// callers locking overlapping sets of fields can't deadlock.
+func (d *DB) lockFields(names []string, write bool) (unlock func()) {
+	d.mu.RLock()
+
+	names = d.expandFields(names)
+	sort.Strings(names)
+
+	var locked []func()
+
+	for i, name := range names {
+		lock, ok := d.fields[name]
+		if !ok || (i > 0 && names[i-1] == name) {
+			// either the query will fail anyway, since the field
+			// doesn't exist, or the field is already locked
+			continue
+		}
+
+		if write {
+			lock.Lock()
+			locked = append(locked, lock.Unlock)
+		} else {
+			lock.RLock()
+			locked = append(locked, lock.RUnlock)
+		}
+	}
+
+	return func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i]()
+		}
+
+		d.mu.RUnlock()
+	}
+}
+
+// AllFields is used in place of the names of top-level fields, when every
+// one of them is needed.
+const AllFields = "*"
+
+// expandFields replaces AllFields in a list of top-level fields with the name
+// of every top-level field.
+func (d *DB) expandFields(names []string) (expanded []string) {
+	for _, name := range names {
+		if name == AllFields {
+			expanded = make([]string, 0, len(d.fields))
+			for field := range d.fields {
+				expanded = append(expanded, field)
+			}
+
+			return expanded
+		}
+	}
+
+	return names
+}
+
+// Fields returns the names of the top-level fields which a selector refers
+// to. If it could refer to any of them, e.g. "*" or "..name", the result is
+// AllFields.
+func (s *Selector) Fields() (names []string) {
+	if s.Call != nil {
+		return s.Call.Selector.Fields()
+	}
+
+	first := s.Clauses[0]
+
+	if first.Wildcard || first.Link == ".." {
+		return []string{AllFields}
+	}
+
+	// a selector like "{users, posts}" projects the root struct
+	if first.Ident == "" && first.Projection != nil {
+		names = append(names, first.Projection.Fields...)
+	} else {
+		names = []string{first.Ident}
+	}
+
+	// "->" reads from another top-level field
+	for _, clause := range s.Clauses[1:] {
+		if clause.Link == "->" {
+			names = append(names, clause.Ident)
+		}
+	}
+
+	return names
+}
+
+// Fields returns the names of the top-level fields which an operation might
+// modify.
+func (op *Operation) Fields() (names []string, err error) {
+	if op.Action != ActionTransaction {
+		selector, err := parseSelector(op.Selector)
+		if err != nil {
+			return nil, err
+		}
+
+		return selector.Fields(), nil
+	}
+
+	for _, sub := range op.Operations {
+		if sub.Action == ActionTransaction {
+			return nil, newError(ErrNOOP, "transactions cannot be nested")
+		}
+
+		fields, err := sub.Fields()
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, fields...)
+	}
+
+	return names, nil
+}
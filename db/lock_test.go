@@ -0,0 +1,247 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+const lockTestSchema = `
+nums: [int]
+names: <string:int>
+todos: [todo]
+total: int
+
+struct todo {
+    completed: bool
+    description: string
+}`
+
+// TestParallelOperations applies operations, reads and compacts the database
+// from many goroutines at once. Run it with -race.
+func TestParallelOperations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "siphon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(lockTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, iterations = 8, 25
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < iterations; j++ {
+				ops := []*Operation{
+					{Action: ActionAppend, Selector: "nums", Payload: float64(j)},
+					{Action: ActionKey, Selector: "names", Payload: map[string]interface{}{
+						"key":   fmt.Sprintf("w%d-%d", i, j),
+						"value": float64(j),
+					}},
+					{Action: ActionAppend, Selector: "todos", Payload: map[string]interface{}{
+						"completed":   false,
+						"description": "todo",
+					}},
+					{Action: ActionUpdate, Selector: "todos[!completed]", Payload: "completed = true"},
+					{Action: ActionIncr, Selector: "total", Payload: float64(1)},
+					{Action: ActionTransaction, Operations: []*Operation{
+						{Action: ActionAppend, Selector: "nums", Payload: float64(-j)},
+						{Action: ActionDecr, Selector: "total", Payload: float64(1)},
+					}},
+				}
+
+				for _, op := range ops {
+					if err := d.Apply(op); err != nil {
+						t.Error(err)
+					}
+				}
+
+				for _, sel := range []string{"nums[> 10]", "names", "todos[completed].count()", "total"} {
+					err := d.Read(sel, nil, func(res Item) error {
+						_ = res.JSON()
+						return nil
+					})
+
+					if err != nil {
+						t.Error(err)
+					}
+				}
+
+				if j%5 == 0 {
+					if err := d.Compact(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenString(lockTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	counts := map[string]string{
+		"nums.count()":             fmt.Sprint(2 * workers * iterations),
+		"names.count()":            fmt.Sprint(workers * iterations),
+		"todos[completed].count()": fmt.Sprint(workers * iterations),
+		"total":                    "0",
+	}
+
+	for sel, want := range counts {
+		for name, database := range map[string]*DB{"original": d, "restored": restored} {
+			res, err := database.QueryString(sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := res.JSON(); got != want {
+				t.Errorf("%s: %s is %s, want %s", name, sel, got, want)
+			}
+		}
+	}
+}
+
+const rollbackTestSchema = `
+nums: [int]
+names: <string:int>
+todos: [todo]
+total: int
+posts: <int:string>
+users: [user]
+
+struct todo {
+    completed: bool
+    description: string
+}
+
+struct user {
+    name: string
+    post_ids: [int] @posts
+}`
+
+// TestParallelRollbacks applies operations which fail, and so have to be
+// undone, while other goroutines read and modify other fields. Run it with
+// -race.
+func TestParallelRollbacks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "siphon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(rollbackTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	d.CheckReferences = true
+
+	err = d.Apply(&Operation{Action: ActionAppend, Selector: "todos", Payload: map[string]interface{}{
+		"completed":   false,
+		"description": "todo",
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, iterations = 4, 25
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+
+		// every one of these operations fails part of the way through
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < iterations; j++ {
+				ops := []*Operation{
+					{Action: ActionUpdate, Selector: "todos", Payload: "completed = true, description = 5"},
+					{Action: ActionTransaction, Operations: []*Operation{
+						{Action: ActionAppend, Selector: "nums", Payload: float64(j)},
+						{Action: ActionSet, Selector: "total", Payload: "x"},
+					}},
+					{Action: ActionAppend, Selector: "users", Payload: map[string]interface{}{
+						"name":     "foo",
+						"post_ids": []interface{}{float64(j)},
+					}},
+				}
+
+				for _, op := range ops {
+					if err := d.Apply(op); err == nil {
+						t.Errorf("%s %s: expected an error", op.Action, op.Selector)
+					}
+				}
+			}
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < iterations; j++ {
+				err := d.Apply(&Operation{Action: ActionKey, Selector: "names", Payload: map[string]interface{}{
+					"key":   fmt.Sprintf("w%d-%d", i, j),
+					"value": float64(j),
+				}})
+
+				if err != nil {
+					t.Error(err)
+				}
+
+				err = d.Read("names", nil, func(res Item) error {
+					_ = res.JSON()
+					return nil
+				})
+
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	counts := map[string]string{
+		"nums.count()":             "0",
+		"users.count()":            "0",
+		"total":                    "0",
+		"todos[completed].count()": "0",
+		"todos.description":        `["todo"]`,
+		"names.count()":            fmt.Sprint(workers * iterations),
+	}
+
+	for sel, want := range counts {
+		res, err := d.QueryString(sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := res.JSON(); got != want {
+			t.Errorf("%s is %s, want %s", sel, got, want)
+		}
+	}
+}
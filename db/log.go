@@ -0,0 +1,142 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LogFile is the name of the file, inside a data directory, which the
+// write-ahead log is stored in.
+const LogFile = "log.jsonl"
+
+// A Log is a write-ahead log of operations. Each operation is stored as a
+// line of JSON, and the file is synced to disk after every write.
+type Log struct {
+	file *os.File
+
+	// size is the length of the file, and last is where the last operation
+	// written to it starts.
+	size, last int64
+}
+
+// OpenLog opens the log in the data directory dir, creating it if it doesn't
+// exist yet. New operations are appended to the end of it.
+func OpenLog(dir string) (log *Log, err error) {
+	f, err := os.OpenFile(filepath.Join(dir, LogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Log{
+		file: f,
+		size: info.Size(),
+		last: info.Size(),
+	}, nil
+}
+
+// Write appends an operation to the log, and waits for it to be written to
+// disk. If it can't be written, anything which was written is removed again,
+// so that the next operation doesn't end up on the same line.
+func (l *Log) Write(op *Operation) (err error) {
+	bytes, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(append(bytes, '\n')); err != nil {
+		l.truncate(l.size)
+		return err
+	}
+
+	if err := l.file.Sync(); err != nil {
+		l.truncate(l.size)
+		return err
+	}
+
+	l.last = l.size
+	l.size += int64(len(bytes) + 1)
+
+	return nil
+}
+
+// Undo removes the last operation written to the log, e.g. because it turned
+// out that it couldn't be applied.
+func (l *Log) Undo() (err error) {
+	return l.truncate(l.last)
+}
+
+// Truncate removes every operation from the log.
+func (l *Log) Truncate() (err error) {
+	return l.truncate(0)
+}
+
+func (l *Log) truncate(size int64) (err error) {
+	if err := l.file.Truncate(size); err != nil {
+		return err
+	}
+
+	l.size, l.last = size, size
+
+	return l.file.Sync()
+}
+
+// Close closes the log's file.
+func (l *Log) Close() (err error) {
+	return l.file.Close()
+}
+
+// ReadLog calls fn for each operation in the log in the data directory dir,
+// in order. If the server crashed while an operation was being written, the
+// last line might be incomplete, in which case it is removed from the file.
+// Any other line which can't be decoded is an error, since the operations
+// after it were committed.
+func ReadLog(dir string, fn func(op *Operation) error) (err error) {
+	f, err := os.OpenFile(filepath.Join(dir, LogFile), os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var (
+		r      = bufio.NewReader(f)
+		offset int64
+	)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) == 0 {
+				return nil
+			}
+
+			// the last line doesn't end with a newline, so it was
+			// never completely written
+			return f.Truncate(offset)
+		} else if err != nil {
+			return err
+		}
+
+		op := &Operation{}
+		if err := DecodeJSON(line, op); err != nil {
+			return newError(ErrUnknown, "could not decode the operation at offset %d of the log: %s", offset, err.Error())
+		}
+
+		if err := fn(op); err != nil {
+			return err
+		}
+
+		offset += int64(len(line))
+	}
+}
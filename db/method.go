@@ -0,0 +1,372 @@
+package db
+
+import "sort"
+
+// A method can be called on the result of a clause in a selector, like
+// "posts.sort(likes)". The arguments are parsed in the same way as filters.
+type method func(item Item, args []*SelectorCondition, params Params) (result Item, err error)
+
+var methods map[string]method
+
+func init() {
+	methods = map[string]method{
+		"sort":  sortMethod,
+		"count": countMethod,
+		"sum":   sumMethod,
+		"avg":   avgMethod,
+		"min":   extremeMethod(Less),
+		"max":   extremeMethod(More),
+
+		"groupby":  groupbyMethod,
+		"distinct": distinctMethod,
+	}
+}
+
+// callMethod calls the method named in a clause on an item.
+func callMethod(item Item, call *SelectorMethod, params Params) (result Item, err error) {
+	fn, ok := methods[call.Name]
+	if !ok {
+		return nil, newError(ErrNOOP, "undefined method %s", call.Name)
+	}
+
+	// an empty argument list is parsed as a single empty condition
+	args := call.Args
+	if len(args) == 1 && args[0].isEmpty() {
+		args = nil
+	}
+
+	return fn(item, args, params)
+}
+
+// elements returns the elements of a list, or the values of a hashmap, along
+// with their type. The values of a hashmap are ordered by their keys' hashes,
+// which are their JSON representations, so that the order is the same every
+// time.
+func elements(item Item) (elems []Item, ty Type, err error) {
+	switch col := item.(type) {
+	case *List:
+		return col.value, col.valType, nil
+
+	case *Hashmap:
+		hashes := make([]string, 0, len(col.data))
+		for hash := range col.data {
+			hashes = append(hashes, hash)
+		}
+
+		sort.Strings(hashes)
+
+		elems = make([]Item, len(hashes))
+		for i, hash := range hashes {
+			elems[i] = col.data[hash]
+		}
+
+		return elems, col.valType, nil
+	}
+
+	return nil, nil, newError(ErrNOOP, "expected a list or hashmap, but got a %s", item.Type())
+}
+
+// sortMethod sorts a list, or the values of a hashmap, returning a new list.
+// Each argument is a key to sort by, and a "-" before a key sorts by it in
+// descending order. With no arguments, the elements themselves are compared.
+// The sort is stable, so elements with equal keys stay in the same order.
+func sortMethod(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+	elems, ty, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		keys = make([]evaluator, len(args))
+		desc = make([]bool, len(args))
+	)
+
+	for i, arg := range args {
+		if val, ok := arg.negatedValue(); ok {
+			keys[i], _, err = valueToEvaluator(val, params)
+			desc[i] = true
+		} else {
+			keys[i], _, err = conditionToEvaluator(arg, params)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(keys) == 0 {
+		keys = []evaluator{identity}
+		desc = []bool{false}
+	}
+
+	type row struct {
+		item Item
+		keys []Item
+	}
+
+	rows := make([]row, len(elems))
+
+	for i, elem := range elems {
+		rows[i] = row{item: elem, keys: make([]Item, len(keys))}
+
+		for k, key := range keys {
+			if rows[i].keys[k], err = key(elem); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k := range keys {
+			a, b := rows[i].keys[k], rows[j].keys[k]
+
+			less, cmpErr := a.Compare(Less, b)
+			if cmpErr != nil && err == nil {
+				err = cmpErr
+			}
+
+			more, cmpErr := a.Compare(More, b)
+			if cmpErr != nil && err == nil {
+				err = cmpErr
+			}
+
+			if less || more {
+				return less != desc[k]
+			}
+		}
+
+		return false
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]Item, len(rows))
+	for i, r := range rows {
+		sorted[i] = r.item
+	}
+
+	return NewList(ty, sorted...), nil
+}
+
+// aggregateValues returns the values which an aggregate method, like sum,
+// should be applied to. These are the elements of item, unless an argument is
+// given, in which case it's evaluated for each element, e.g. "posts.sum(likes)".
+func aggregateValues(name string, item Item, args []*SelectorCondition, params Params) (vals []Item, err error) {
+	elems, _, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 {
+		return elems, nil
+	} else if len(args) > 1 {
+		return nil, newError(ErrNOOP, "%s takes at most one argument", name)
+	}
+
+	return evaluateEach(args[0], elems, params)
+}
+
+// evaluateEach evaluates an argument for each of the items.
+func evaluateEach(arg *SelectorCondition, items []Item, params Params) (vals []Item, err error) {
+	eval, _, err := conditionToEvaluator(arg, params)
+	if err != nil {
+		return nil, err
+	}
+
+	vals = make([]Item, len(items))
+	for i, item := range items {
+		if vals[i], err = eval(item); err != nil {
+			return nil, err
+		}
+	}
+
+	return vals, nil
+}
+
+// countMethod returns the number of elements in a list or hashmap.
+func countMethod(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+	if len(args) > 0 {
+		return nil, newError(ErrNOOP, "count takes no arguments")
+	}
+
+	elems, _, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewInt(int64(len(elems))), nil
+}
+
+// sumMethod adds up the elements of a list or hashmap, which must be numeric.
+// If every element is an integer, the sum is an exact integer, and otherwise
+// it's a Float.
+func sumMethod(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+	vals, err := aggregateValues("sum", item, args, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return sumNumeric(vals)
+}
+
+// avgMethod returns the mean of the elements of a list or hashmap, which must
+// be numeric. The result is always a Float.
+func avgMethod(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+	vals, err := aggregateValues("avg", item, args, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vals) == 0 {
+		return nil, newError(ErrIndex, "cannot take the average of nothing")
+	}
+
+	total, err := sumNumeric(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, _ := castNumeric(total)
+
+	return NewFloat(sum / float64(len(vals))), nil
+}
+
+// sumNumeric adds up some numbers with arithmetic, so integers are added
+// exactly.
+func sumNumeric(vals []Item) (total Item, err error) {
+	total = NewInt(0)
+
+	for _, val := range vals {
+		if _, ok := castNumeric(val); !ok {
+			return nil, newError(ErrType, "cannot add a %s", val.Type())
+		}
+
+		if total, err = arithmetic("+", total, val); err != nil {
+			return nil, err
+		}
+	}
+
+	return total, nil
+}
+
+// extremeMethod makes a method which returns the element which is the most
+// extreme in the given direction, i.e. the smallest for Less and the largest
+// for More. It works on anything which can be compared, including strings.
+func extremeMethod(kind Comparison) method {
+	return func(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+		name := "min"
+		if kind == More {
+			name = "max"
+		}
+
+		vals, err := aggregateValues(name, item, args, params)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(vals) == 0 {
+			return nil, newError(ErrIndex, "cannot take the %s of nothing", name)
+		}
+
+		result = vals[0]
+
+		for _, val := range vals[1:] {
+			better, err := val.Compare(kind, result)
+			if err != nil {
+				return nil, err
+			}
+
+			if better {
+				result = val
+			}
+		}
+
+		return result, nil
+	}
+}
+
+// groupbyMethod groups the elements of a list or hashmap by the value of its
+// argument, returning a hashmap from each value to a list of the elements
+// with that value. Within each group, the elements stay in the same order.
+func groupbyMethod(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+	if len(args) != 1 {
+		return nil, newError(ErrNOOP, "groupby takes exactly one argument")
+	}
+
+	elems, ty, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := evaluateEach(args[0], elems, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyType Type = &AnyType{}
+	if len(keys) > 0 {
+		keyType = keys[0].Type()
+	}
+
+	var (
+		groups = NewHashmap(keyType, &ListType{ElemType: ty})
+		lists  = make(map[string]*List)
+	)
+
+	for i, elem := range elems {
+		hash := hashKey(keys[i])
+
+		list, ok := lists[hash]
+		if !ok {
+			list = NewList(ty)
+			lists[hash] = list
+
+			// the key is copied, since it might be a field of the element
+			if err := groups.SetKey(copyItem(keys[i]), list); err != nil {
+				return nil, err
+			}
+		}
+
+		list.value = append(list.value, elem)
+	}
+
+	return groups, nil
+}
+
+// distinctMethod returns a list of the unique elements of a list or hashmap,
+// in the order they first appear. If an argument is given, the elements are
+// compared by its value instead, and the first element with each value is
+// kept.
+func distinctMethod(item Item, args []*SelectorCondition, params Params) (result Item, err error) {
+	if len(args) > 1 {
+		return nil, newError(ErrNOOP, "distinct takes at most one argument")
+	}
+
+	elems, ty, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := elems
+	if len(args) == 1 {
+		if keys, err = evaluateEach(args[0], elems, params); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		unique = NewList(ty)
+		seen   = make(map[string]bool, len(elems))
+	)
+
+	for i, elem := range elems {
+		if hash := hashKey(keys[i]); !seen[hash] {
+			seen[hash] = true
+			unique.value = append(unique.value, elem)
+		}
+	}
+
+	return unique, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import "testing"
+
+const methodTestSchema = `
+posts: [post]
+
+struct author {
+    name: string
+    age: int
+}
+
+struct post {
+    title: string
+    author: author
+    tags: [string]
+}`
+
+func TestGroupbyAndDistinct(t *testing.T) {
+	d, err := OpenString(methodTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := []map[string]interface{}{
+		{"title": "a", "author": map[string]interface{}{"name": "ann", "age": 30}, "tags": []string{"x", "y"}},
+		{"title": "b", "author": map[string]interface{}{"name": "bob", "age": 40}, "tags": []string{"x"}},
+		{"title": "c", "author": map[string]interface{}{"name": "ann", "age": 30}, "tags": []string{"y", "x"}},
+		{"title": "d", "author": map[string]interface{}{"name": "ann", "age": 31}, "tags": []string{"x", "y"}},
+	}
+
+	for _, post := range posts {
+		if err := d.Append("posts", nil, post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		selector, want string
+	}{
+		{"posts.groupby(author).count()", "3"},
+		{"posts.groupby(tags).count()", "3"},
+		{"posts.distinct(author).title", `["a", "b", "d"]`},
+		{"posts.distinct(tags).title", `["a", "b", "c"]`},
+		{"posts.author.distinct().count()", "3"},
+		{"posts.groupby(author).*.title", `["a", "c", "d", "b"]`},
+		{"posts.groupby(tags).*.title", `["a", "d", "b", "c"]`},
+	}
+
+	for _, c := range cases {
+		res, err := d.QueryString(c.selector)
+		if err != nil {
+			t.Errorf("%s: %s", c.selector, err)
+			continue
+		}
+
+		if got := res.JSON(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.selector, got, c.want)
+		}
+	}
+}
+
+// TestGroupbyRecursive checks that structs which contain themselves can be
+// grouped, which type checks them against each other.
+func TestGroupbyRecursive(t *testing.T) {
+	d, err := OpenString(`
+me: user
+people: <string:user>
+
+struct user {
+    name: string
+    age: int
+    friends: [user]
+}`, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	me := map[string]interface{}{
+		"name": "me",
+		"age":  30,
+		"friends": []interface{}{
+			map[string]interface{}{"name": "a", "age": 30, "friends": []interface{}{}},
+			map[string]interface{}{"name": "b", "age": 40, "friends": []interface{}{}},
+			map[string]interface{}{"name": "c", "age": 30, "friends": []interface{}{}},
+		},
+	}
+
+	if err := d.Set("me", nil, me); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Key("people", nil, "me", me); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		selector, want string
+	}{
+		{"me.friends.groupby(age).count()", "2"},
+		{"me.friends.groupby(age).*.name", `["a", "c", "b"]`},
+		{"me.friends.distinct(age).name", `["a", "b"]`},
+		{"people.groupby(age).count()", "1"},
+	}
+
+	for _, c := range cases {
+		res, err := d.QueryString(c.selector)
+		if err != nil {
+			t.Errorf("%s: %s", c.selector, err)
+			continue
+		}
+
+		if got := res.JSON(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.selector, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package db
+
+// Null is the value of the "null" literal in selectors, and of null values in
+// params. It's never stored in the database, but comparing a field or key which
+// doesn't exist with null, e.g. "users[email = null]", holds.
+type Null struct {
+	*itemDefaults
+}
+
+// NewNull makes a new null item.
+func NewNull() *Null {
+	return &Null{}
+}
+
+// Type returns the type of an item
+func (n *Null) Type() Type {
+	return &AnyType{}
+}
+
+func (n *Null) String() string {
+	return "null"
+}
+
+// JSON returns a JSON representation of the item
+func (n *Null) JSON() string {
+	return "null"
+}
+
+// Compare compares two items. Null is only equal to itself.
+func (n *Null) Compare(kind Comparison, other Item) (result bool, err error) {
+	_, isNull := other.(*Null)
+
+	switch kind {
+	case Equal:
+		return isNull, nil
+	case NotEqual:
+		return !isNull, nil
+	default:
+		return false, newError(ErrNOOP, "only = and != are supported on null")
+	}
+}
@@ -0,0 +1,289 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"strconv"
+)
+
+// DecodeJSON is like json.Unmarshal, except that numbers are decoded as
+// json.Numbers instead of float64s, so large integers don't lose precision.
+// Anything which might be passed to Item.Set should be decoded with it.
+func DecodeJSON(data []byte, v interface{}) (err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return newError(ErrType, "unexpected data after the JSON value")
+	}
+
+	return nil
+}
+
+// jsonNumber gets the text of a number decoded from JSON, which is either a
+// json.Number, if it was decoded by DecodeJSON, or a float64.
+func jsonNumber(val interface{}) (num string, ok bool) {
+	switch v := val.(type) {
+	case json.Number:
+		return v.String(), true
+
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	}
+
+	return "", false
+}
+
+// integerRange returns the smallest and largest values of an integer type.
+func integerRange(ty Type) (min, max *big.Int) {
+	var (
+		signed = true
+		bits   uint
+	)
+
+	switch ty.(type) {
+	case *IntType:
+		bits = 64
+	case *Int32Type:
+		bits = 32
+	case *Int16Type:
+		bits = 16
+	case *Int8Type:
+		bits = 8
+
+	case *UintType:
+		signed, bits = false, 64
+	case *Uint32Type:
+		signed, bits = false, 32
+	case *Uint16Type:
+		signed, bits = false, 16
+	case *Uint8Type:
+		signed, bits = false, 8
+	}
+
+	one := big.NewInt(1)
+
+	if !signed {
+		max = new(big.Int).Lsh(one, bits)
+		return big.NewInt(0), max.Sub(max, one)
+	}
+
+	max = new(big.Int).Lsh(one, bits-1)
+	min = new(big.Int).Neg(max)
+
+	return min, max.Sub(max, one)
+}
+
+// parseInteger parses a number decoded from JSON as a value of an integer
+// type, checking that it's a whole number in the type's range.
+func parseInteger(val interface{}, ty Type) (result *big.Int, err error) {
+	num, ok := jsonNumber(val)
+	if !ok {
+		return nil, newError(ErrType, "expected an integer value")
+	}
+
+	result, ok = new(big.Int).SetString(num, 10)
+	if !ok {
+		// it could still be whole, like 1e3 or 2.0
+		f, _, err := big.ParseFloat(num, 10, 256, big.ToNearestEven)
+		if err != nil {
+			return nil, newError(ErrType, "expected an integer value")
+		}
+
+		if !f.IsInt() {
+			return nil, newError(ErrType, "%s is not an integer", num)
+		}
+
+		result, _ = f.Int(nil)
+	}
+
+	if min, max := integerRange(ty); result.Cmp(min) < 0 || result.Cmp(max) > 0 {
+		return nil, newError(ErrType, "%s is out of range for %s", num, ty)
+	}
+
+	return result, nil
+}
+
+// parseFloat parses a number decoded from JSON as a float with the given
+// number of bits, checking that it's in range.
+func parseFloat(val interface{}, bits int, ty Type) (result float64, err error) {
+	num, ok := jsonNumber(val)
+	if !ok {
+		return 0, newError(ErrType, "expected a float value")
+	}
+
+	result, err = strconv.ParseFloat(num, bits)
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+			return 0, newError(ErrType, "%s is out of range for %s", num, ty)
+		}
+
+		return 0, newError(ErrType, "expected a float value")
+	}
+
+	return result, nil
+}
+
+// updateNumber performs one of the numeric actions on an item, modifying it in
+// place. For ActionIncr and ActionDecr, payload is the amount to add or
+// subtract, or nil for 1. For ActionMin and ActionMax, the item is set to the
+// smaller or larger of its current value and the payload. Either way, the new
+// value is set using Set, so it's checked to be in range.
+func updateNumber(item Item, action Action, payload interface{}) (err error) {
+	if !isNumber(item) {
+		return newError(ErrType, "can only %s numbers, but got a %s", action, item.Type())
+	}
+
+	if payload == nil {
+		payload = json.Number("1")
+	}
+
+	amount, ok := jsonNumber(payload)
+	if !ok {
+		return newError(ErrType, "expected a number to %s by", action)
+	}
+
+	// 64 bit floats can't hold every int64 or uint64, so 256 bits are used
+	current, _, err := big.ParseFloat(item.String(), 10, 256, big.ToNearestEven)
+	if err != nil {
+		return newError(ErrType, "could not parse %s", item)
+	}
+
+	operand, _, err := big.ParseFloat(amount, 10, 256, big.ToNearestEven)
+	if err != nil {
+		return newError(ErrType, "expected a number to %s by", action)
+	}
+
+	var result *big.Float
+
+	switch action {
+	case ActionIncr:
+		result = current.Add(current, operand)
+
+	case ActionDecr:
+		result = current.Sub(current, operand)
+
+	case ActionMin, ActionMax:
+		cmp := operand.Cmp(current)
+		if (action == ActionMin && cmp >= 0) || (action == ActionMax && cmp <= 0) {
+			return nil
+		}
+
+		return item.Set(payload)
+
+	default:
+		return newError(ErrNOOP, "invalid numeric action: %s", action)
+	}
+
+	text := result.Text('f', -1)
+
+	switch item.(type) {
+	case *Float, *Float32:
+		text = result.Text('g', -1)
+	}
+
+	return item.Set(json.Number(text))
+}
+
+// isNumber checks whether an item is one of the numeric types.
+func isNumber(item Item) bool {
+	switch item.(type) {
+	case *Float, *Float32, *Int, *Int32, *Int16, *Int8, *Uint, *Uint32, *Uint16, *Uint8:
+		return true
+	}
+
+	return false
+}
+
+// isInteger checks whether an item is one of the integer types.
+func isInteger(item Item) bool {
+	switch item.(type) {
+	case *Int, *Int32, *Int16, *Int8, *Uint, *Uint32, *Uint16, *Uint8:
+		return true
+	}
+
+	return false
+}
+
+// compareNumbers compares two numeric items, returning -1, 0 or +1 if left is
+// less than, equal to or more than right. They're compared exactly, since
+// 64 bit floats can't hold every int64 or uint64.
+func compareNumbers(left, right Item) (cmp int, ok bool) {
+	l, _, err := big.ParseFloat(left.String(), 10, 256, big.ToNearestEven)
+	if err != nil {
+		return 0, false
+	}
+
+	r, _, err := big.ParseFloat(right.String(), 10, 256, big.ToNearestEven)
+	if err != nil {
+		return 0, false
+	}
+
+	return l.Cmp(r), true
+}
+
+// integerArithmetic applies an arithmetic operator to two integers exactly.
+// The result is an integer, unless it's a division with a remainder, in which
+// case it's a float.
+func integerArithmetic(operator string, left, right Item) (result Item, err error) {
+	l, lok := new(big.Int).SetString(left.String(), 10)
+	r, rok := new(big.Int).SetString(right.String(), 10)
+	if !lok || !rok {
+		return nil, newError(ErrType, "cannot apply %s to %s and %s", operator, left.Type(), right.Type())
+	}
+
+	switch operator {
+	case "+":
+		return bigIntToItem(l.Add(l, r)), nil
+
+	case "-":
+		return bigIntToItem(l.Sub(l, r)), nil
+
+	case "*":
+		return bigIntToItem(l.Mul(l, r)), nil
+
+	case "/":
+		if r.Sign() == 0 {
+			return nil, newError(ErrNOOP, "division by zero")
+		}
+
+		quo, rem := new(big.Int).QuoRem(l, r, new(big.Int))
+		if rem.Sign() == 0 {
+			return bigIntToItem(quo), nil
+		}
+
+		f, _ := new(big.Float).Quo(new(big.Float).SetInt(l), new(big.Float).SetInt(r)).Float64()
+		return NewFloat(f), nil
+
+	case "%":
+		if r.Sign() == 0 {
+			return nil, newError(ErrNOOP, "division by zero")
+		}
+
+		return bigIntToItem(l.Rem(l, r)), nil
+
+	default:
+		return nil, newError(ErrNOOP, "invalid arithmetic operator: %s", operator)
+	}
+}
+
+// bigIntToItem converts an integer to an Int, or to a Uint if it's too large.
+// If it doesn't fit either of them, it becomes a Float.
+func bigIntToItem(val *big.Int) Item {
+	if val.IsInt64() {
+		return NewInt(val.Int64())
+	}
+
+	if val.IsUint64() {
+		return NewUint(val.Uint64())
+	}
+
+	f, _ := new(big.Float).SetInt(val).Float64()
+	return NewFloat(f)
+}
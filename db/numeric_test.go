@@ -0,0 +1,86 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const numericTestSchema = `
+big: [int]
+huge: [uint]
+ratios: [float]
+posts: [post]
+
+struct post {
+    likes: int
+}`
+
+// TestExactNumbers checks that integers too large for a float64 are compared
+// and updated without losing precision.
+func TestExactNumbers(t *testing.T) {
+	d, err := OpenString(numericTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := []*Operation{
+		{Action: ActionAppend, Selector: "big", Payload: json.Number("9007199254740993")},
+		{Action: ActionAppend, Selector: "big", Payload: json.Number("-5")},
+		{Action: ActionAppend, Selector: "huge", Payload: json.Number("18446744073709551615")},
+		{Action: ActionSet, Selector: "ratios", Payload: []interface{}{json.Number("1.5"), json.Number("2")}},
+		{Action: ActionAppend, Selector: "posts", Payload: map[string]interface{}{"likes": json.Number("9007199254740993")}},
+		{Action: ActionUpdate, Selector: "posts", Payload: "likes += 0"},
+	}
+
+	for _, op := range ops {
+		if err := d.Apply(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		selector, want string
+	}{
+		{"big[= 9007199254740992]", "[]"},
+		{"big[= 9007199254740993]", "[9007199254740993]"},
+		{"big[> 9007199254740992]", "[9007199254740993]"},
+		{"big[< -4]", "[-5]"},
+		{"big[= -(10 - 5)]", "[-5]"},
+		{"huge[= 18446744073709551615]", "[18446744073709551615]"},
+		{"huge[= 18446744073709551614]", "[]"},
+		{"huge[= 18446744073709551614 + 1]", "[18446744073709551615]"},
+		{"posts.likes", "[9007199254740993]"},
+		{"posts[likes - 9007199254740992 = 1].count()", "1"},
+		{"posts[likes / 3 = 3002399751580331].count()", "1"},
+		{"posts[likes % 2 = 1].count()", "1"},
+		{"big[= 7 / 2 * 2].count()", "0"},
+		{"big.sum()", "9007199254740988"},
+		{"sum(huge)", "18446744073709551615"},
+		{"posts.sum(likes)", "9007199254740993"},
+		{"ratios.sum()", "3.5"},
+		{"big[> 9007199254740993].sum()", "0"},
+		{"big[> 0].avg()", "9.007199254740992e+15"},
+	}
+
+	for _, c := range cases {
+		res, err := d.QueryString(c.selector)
+		if err != nil {
+			t.Errorf("%s: %s", c.selector, err)
+			continue
+		}
+
+		if got := res.JSON(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.selector, got, c.want)
+		}
+	}
+
+	if err := d.Apply(&Operation{Action: ActionUpdate, Selector: "posts", Payload: "likes += 2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := d.QueryString("posts.likes"); err != nil {
+		t.Fatal(err)
+	} else if got := res.JSON(); got != "[9007199254740995]" {
+		t.Errorf("after likes += 2, got %s, want [9007199254740995]", got)
+	}
+}
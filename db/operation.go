@@ -0,0 +1,372 @@
+package db
+
+// An Action is a kind of modification which can be made to the database.
+type Action string
+
+// The different kinds of action. Each one corresponds to one of the HTTP
+// routes which modify data.
+const (
+	ActionSet     Action = "set"
+	ActionUnset   Action = "unset"
+	ActionAppend  Action = "append"
+	ActionPrepend Action = "prepend"
+	ActionKey     Action = "key"
+	ActionEmpty   Action = "empty"
+
+	// ActionUpdate sets fields of every element of the selected list or
+	// hashmap, like "UPDATE ... WHERE" in SQL.
+	ActionUpdate Action = "update"
+
+	// ActionDelete removes every element of a list or hashmap which matches
+	// the last filter of the selector, e.g. "todos[completed]".
+	ActionDelete Action = "delete"
+
+	// ActionIncr and ActionDecr add to or subtract from a number, and
+	// ActionMin and ActionMax set a number to the smaller or larger of its
+	// current value and the payload. The read and the write are atomic, and
+	// the result is checked to fit into the number's type.
+	ActionIncr Action = "incr"
+	ActionDecr Action = "decr"
+	ActionMin  Action = "min"
+	ActionMax  Action = "max"
+
+	// ActionTransaction applies a list of operations, either all of them
+	// or none of them.
+	ActionTransaction Action = "tx"
+)
+
+// An Operation is a single modification to the database. Operations are what
+// is written to the log, so that they can be replayed later.
+type Operation struct {
+	// Seq is the position of the operation in the log. It is set when the
+	// operation is logged.
+	Seq uint64 `json:"seq"`
+
+	Action   Action                 `json:"action"`
+	Selector string                 `json:"selector"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Payload  interface{}            `json:"payload,omitempty"`
+
+	// Operations are the operations making up a transaction.
+	Operations []*Operation `json:"operations,omitempty"`
+
+	// Removed is set to the number of elements removed by a delete operation
+	// once it has been applied. It isn't logged.
+	Removed int `json:"-"`
+
+	// Result is set to the JSON representation of a number after a numeric
+	// operation, e.g. incr, has been applied to it. It isn't logged.
+	Result string `json:"-"`
+}
+
+// Apply performs an operation on the database. If the database has a log,
+// the operation is written to it before Apply returns. If the operation fails,
+// or can't be written to the log, none of its changes are kept.
+func (d *DB) Apply(op *Operation) (err error) {
+	op.resolveBuiltins()
+
+	fields, err := op.Fields()
+	if err != nil {
+		return err
+	}
+
+	fields = d.expandFields(fields)
+	check, needed := d.referencingFields(fields)
+
+	unlock := d.lockFields(append(needed, fields...), true)
+	defer unlock()
+
+	// Any other operation either succeeds or changes nothing, so it can be
+	// logged before it's applied, and nothing needs to be backed up.
+	if op.Action != ActionTransaction && op.Action != ActionUpdate && len(check) == 0 {
+		return d.applyLogged(op)
+	}
+
+	// Transactions and updates can fail part of the way through, and
+	// references are checked after the operation has been applied, so the
+	// fields they change are backed up first.
+	backups := d.backupFields(fields)
+
+	err = d.apply(op)
+	if err == nil {
+		err = d.checkReferences(check)
+	}
+
+	if err == nil {
+		err = d.logOperation(op)
+	}
+
+	if err != nil {
+		d.restoreFields(backups)
+		return err
+	}
+
+	return nil
+}
+
+// applyLogged applies an operation which either succeeds or changes nothing.
+// If the database has a log, the operation is written to it first, and then
+// removed again if it fails. The log stays locked in between, so that no other
+// operation can be written after it.
+func (d *DB) applyLogged(op *Operation) (err error) {
+	if d.log == nil {
+		if err := d.apply(op); err != nil {
+			return err
+		}
+
+		return d.logOperation(op)
+	}
+
+	d.seqMu.Lock()
+	defer d.seqMu.Unlock()
+
+	op.Seq = d.seq + 1
+
+	if err := d.log.Write(op); err != nil {
+		return err
+	}
+
+	if err := d.apply(op); err != nil {
+		if lerr := d.log.Undo(); lerr != nil {
+			return newError(ErrUnknown, "%s, and it could not be removed from the log: %s", err.Error(), lerr.Error())
+		}
+
+		return err
+	}
+
+	d.seq = op.Seq
+
+	return nil
+}
+
+// logOperation gives op the next sequence number, and writes it to the log if
+// the database has one. If it can't be written, the sequence number is
+// given back.
+func (d *DB) logOperation(op *Operation) (err error) {
+	d.seqMu.Lock()
+	defer d.seqMu.Unlock()
+
+	d.seq++
+
+	if d.log == nil {
+		return nil
+	}
+
+	op.Seq = d.seq
+
+	if err := d.log.Write(op); err != nil {
+		d.seq--
+		return err
+	}
+
+	return nil
+}
+
+// backupFields copies the given top-level fields, so that they can be put
+// back with restoreFields.
+func (d *DB) backupFields(fields []string) (backups map[string]Item) {
+	backups = make(map[string]Item, len(fields))
+
+	for _, name := range fields {
+		if val, err := d.data.GetField(name); err == nil {
+			backups[name] = copyItem(val)
+		}
+	}
+
+	return backups
+}
+
+// restoreFields puts back top-level fields which were copied by backupFields.
+// Only the fields themselves are locked, so their contents are restored in
+// place, since other fields could be being read from the root struct.
+func (d *DB) restoreFields(backups map[string]Item) {
+	for name, backup := range backups {
+		if val, err := d.data.GetField(name); err == nil {
+			restoreItem(val, backup)
+		}
+	}
+}
+
+// apply performs an operation without locking the database or logging it.
+// If a transaction fails part of the way through, the operations before the
+// failure are not undone.
+func (d *DB) apply(op *Operation) (err error) {
+	if op.Action == ActionTransaction {
+		for i, sub := range op.Operations {
+			if err := d.apply(sub); err != nil {
+				if e, ok := err.(*Error); ok {
+					return newError(e.Type, "operation %d failed: %s", i, e.Message)
+				}
+
+				return newError(ErrUnknown, "operation %d failed: %s", i, err.Error())
+			}
+		}
+
+		return nil
+	}
+
+	selector, err := parseSelector(op.Selector)
+	if err != nil {
+		return err
+	}
+
+	params, err := ParamsFromJSON(op.Params)
+	if err != nil {
+		return err
+	}
+
+	if op.Action == ActionDelete {
+		op.Removed, err = d.deleteWhere(selector, params)
+		return err
+	}
+
+	item, copied, err := d.target(selector, params)
+	if err != nil {
+		return err
+	}
+
+	// an update modifies the elements, which are still the ones in the
+	// database, but anything else would only modify the copy
+	if copied && op.Action != ActionUpdate {
+		return newError(ErrNOOP, "cannot %s the result of a filter, slice or ->, since it's a copy; use update to modify its elements", op.Action)
+	}
+
+	switch op.Action {
+	case ActionSet:
+		return item.Set(op.Payload)
+
+	case ActionUnset:
+		return item.UnsetKeyJSON(op.Payload)
+
+	case ActionAppend:
+		return item.AppendJSON(op.Payload)
+
+	case ActionPrepend:
+		return item.PrependJSON(op.Payload)
+
+	case ActionKey:
+		kv, ok := op.Payload.(map[string]interface{})
+		if !ok {
+			return newError(ErrType, "expected an object with 'key' and 'value' fields")
+		}
+
+		return item.SetKeyJSON(kv["key"], kv["value"])
+
+	case ActionEmpty:
+		return item.Empty()
+
+	case ActionIncr, ActionDecr, ActionMin, ActionMax:
+		if err := updateNumber(item, op.Action, op.Payload); err != nil {
+			return err
+		}
+
+		op.Result = item.JSON()
+		return nil
+
+	case ActionUpdate:
+		upd, err := makeUpdate(op.Payload, params)
+		if err != nil {
+			return err
+		}
+
+		return upd.applyEach(item)
+
+	default:
+		return newError(ErrNOOP, "invalid action: %s", op.Action)
+	}
+}
+
+// target finds the item which an operation modifies. Unlike QueryWithParams, it
+// makes sure that the item is the one stored in the database, and not one which
+// was made by the query, since modifying that would have no effect. So fields
+// can only be taken of a struct or a hashmap with string keys, not of every
+// element of a list, and wildcards, "..", methods and projections can't be
+// used.
+//
+// Filters, slices and looking up a list of IDs with "->" make a new list or
+// hashmap, but its elements are still the ones in the database. If the item is
+// one of those, copied is true.
+func (d *DB) target(selector *Selector, params Params) (item Item, copied bool, err error) {
+	if selector.Call != nil {
+		return nil, false, newError(ErrNOOP, "cannot modify the result of a method")
+	}
+
+	item = d.data
+
+	for i, clause := range selector.Clauses {
+		if i > 0 && clause.Link == "" {
+			return nil, false, newError(ErrNOOP, "expected . or -> between clauses %d and %d", i, i+1)
+		} else if i == 0 && clause.Link == "->" {
+			return nil, false, newError(ErrNOOP, "a selector cannot start with ->")
+		}
+
+		if clause.Ident == "" || clause.Link == ".." || clause.Projection != nil {
+			return nil, false, newError(ErrNOOP, "clause %d: only fields, keys, filters, slices and -> can select what to modify", i)
+		}
+
+		if clause.Link == "->" {
+			// looking up a list or hashmap of IDs makes a new list
+			switch item.(type) {
+			case *List, *Hashmap:
+				copied = true
+			default:
+				copied = false
+			}
+
+			if item, err = d.dereference(item, clause.Ident); err != nil {
+				return nil, false, err
+			}
+		} else {
+			if mapsFields(item) {
+				return nil, false, newError(ErrNOOP, "clause %d: cannot modify a field of every element of a list or hashmap", i)
+			}
+
+			if item, err = item.GetField(clause.Ident); err != nil {
+				return nil, false, err
+			}
+
+			copied = false
+		}
+
+		for _, filter := range clause.Filters {
+			if item, copied, err = applyTargetFilter(item, copied, filter, params); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	return item, copied, nil
+}
+
+// applyTargetFilter applies a filter for target. A key gets one of the elements,
+// which is in the database, but a slice or any other filter makes a new list or
+// hashmap.
+func applyTargetFilter(item Item, copied bool, filter *SelectorFilter, params Params) (result Item, resultCopied bool, err error) {
+	if filter.Slice {
+		start, end, err := sliceBounds(filter, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		result, err = item.Slice(start, end)
+		return result, true, err
+	}
+
+	eval, isConstant, err := filterToEvaluator(filter, item.Type(), params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !isConstant {
+		result, err = item.Filter(evaluatorToPredicate(eval))
+		return result, true, err
+	}
+
+	key, err := eval(nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	result, err = item.GetKey(key)
+	return result, false, err
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+)
+
+// dereference looks up an ID as a key of the top-level list or hashmap named
+// target. If item is a list or hashmap of IDs, each of them is looked up and
+// a list of the results is returned.
+func (d *DB) dereference(item Item, target string) (result Item, err error) {
+	coll, err := d.data.GetField(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var elemType Type
+
+	switch ty := coll.Type().(type) {
+	case *ListType:
+		elemType = ty.ElemType
+	case *HashmapType:
+		elemType = ty.ValType
+	default:
+		return nil, newError(ErrNOOP, "cannot look up IDs in %s, which is a %s", target, ty)
+	}
+
+	switch item.(type) {
+	case *List, *Hashmap:
+	default:
+		return coll.GetKey(item)
+	}
+
+	ids, _, err := elements(item)
+	if err != nil {
+		return nil, err
+	}
+
+	list := NewList(elemType)
+
+	for _, id := range ids {
+		val, err := coll.GetKey(id)
+		if err != nil {
+			return nil, err
+		}
+
+		list.value = append(list.value, val)
+	}
+
+	return list, nil
+}
+
+// findReferences finds the top-level fields which each top-level field refers
+// to, through the annotated fields inside it.
+func findReferences(root *StructType) (refs map[string][]string, err error) {
+	refs = make(map[string][]string)
+
+	for name, ty := range root.Fields {
+		targets := make(map[string]bool)
+
+		if target, ok := root.Refs[name]; ok {
+			targets[target] = true
+		}
+
+		typeReferences(ty, targets, make(map[*StructType]bool))
+
+		for target := range targets {
+			switch root.Fields[target].(type) {
+			case *ListType, *HashmapType:
+			default:
+				return nil, fmt.Errorf("db init: %s refers to %s, which isn't a top-level list or hashmap", name, target)
+			}
+
+			refs[name] = append(refs[name], target)
+		}
+
+		sort.Strings(refs[name])
+	}
+
+	return refs, nil
+}
+
+// typeReferences adds the targets of every annotated field inside a value of
+// type ty to targets.
+func typeReferences(ty Type, targets map[string]bool, seen map[*StructType]bool) {
+	switch t := ty.(type) {
+	case *StructType:
+		// structs can contain themselves, e.g. a user's friends
+		if seen[t] {
+			return
+		}
+
+		seen[t] = true
+
+		for _, target := range t.Refs {
+			targets[target] = true
+		}
+
+		for _, field := range t.Fields {
+			typeReferences(field, targets, seen)
+		}
+
+	case *ListType:
+		typeReferences(t.ElemType, targets, seen)
+
+	case *HashmapType:
+		typeReferences(t.ValType, targets, seen)
+	}
+}
+
+// referencingFields returns the top-level fields whose references should be
+// checked after modifying the given fields, i.e. those which are modified and
+// contain references, and those which refer to a modified field. The second
+// result is every field which is needed to check them.
+func (d *DB) referencingFields(fields []string) (check, needed []string) {
+	if !d.CheckReferences {
+		return nil, nil
+	}
+
+	modified := make(map[string]bool, len(fields))
+	for _, name := range fields {
+		modified[name] = true
+	}
+
+	for source, targets := range d.references {
+		affected := modified[source]
+
+		for _, target := range targets {
+			affected = affected || modified[target]
+		}
+
+		if affected {
+			check = append(check, source)
+			needed = append(needed, source)
+			needed = append(needed, targets...)
+		}
+	}
+
+	return check, needed
+}
+
+// checkReferences checks that every annotated ID inside the given top-level
+// fields refers to something which exists.
+func (d *DB) checkReferences(fields []string) (err error) {
+	for _, name := range fields {
+		val, err := d.data.GetField(name)
+		if err != nil {
+			return err
+		}
+
+		if target, ok := d.data.ty.Refs[name]; ok {
+			if err := d.checkReference(name, val, target); err != nil {
+				return err
+			}
+		}
+
+		if err := d.checkItemReferences(name, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkItemReferences checks the references inside an item. path is used to
+// say where a broken reference is.
+func (d *DB) checkItemReferences(path string, item Item) (err error) {
+	switch it := item.(type) {
+	case *Struct:
+		for name, val := range it.value {
+			if target, ok := it.ty.Refs[name]; ok {
+				if err := d.checkReference(path+"."+name, val, target); err != nil {
+					return err
+				}
+			}
+
+			if err := d.checkItemReferences(path+"."+name, val); err != nil {
+				return err
+			}
+		}
+
+	case *List:
+		for _, elem := range it.value {
+			if err := d.checkItemReferences(path, elem); err != nil {
+				return err
+			}
+		}
+
+	case *Hashmap:
+		for _, val := range it.data {
+			if err := d.checkItemReferences(path, val); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkReference checks that an ID, or each of a list of IDs, exists in the
+// target field.
+func (d *DB) checkReference(path string, val Item, target string) (err error) {
+	coll, err := d.data.GetField(target)
+	if err != nil {
+		return err
+	}
+
+	ids := []Item{val}
+	if list, ok := val.(*List); ok {
+		ids = list.value
+	}
+
+	for _, id := range ids {
+		if _, err := coll.GetKey(id); err != nil {
+			return newError(ErrIndex, "%s refers to %s in %s, which does not exist", path, id, target)
+		}
+	}
+
+	return nil
+}
@@ -25,7 +25,7 @@ func (r *Regexp) String() string {
 
 // JSON returns a JSON representation of an item
 func (r *Regexp) JSON() string {
-	return "\"" + r.value + "\""
+	return quoteJSON(r.value)
 }
 
 // Set sets the value of the item to the given value
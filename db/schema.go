@@ -10,7 +10,7 @@ var schemaLexer = lexer.Must(lexer.Regexp(`(?P<Newline>\n)` +
 	`|(#.*$)` +
 	`|(?P<Keyword>struct)` +
 	`|(?P<Ident>[\p{L}\p{M}_-][\p{L}\p{M}\d_-]*)` +
-	`|(?P<Punctuation>[:{}\[\]<>])`,
+	`|(?P<Punctuation>[:{}\[\]<>@])`,
 ))
 
 // SchemaParser parses schemas.
@@ -36,10 +36,13 @@ type SchemaSection struct {
 	Struct *SchemaStruct `| @@`
 }
 
-// A SchemaField defines a field in the schema or in a struct.
+// A SchemaField defines a field in the schema or in a struct. A field holding
+// IDs can be annotated with the top-level field they refer to, like
+// "post_ids: [int] @posts".
 type SchemaField struct {
-	Name string      `@Ident`
-	Type *SchemaType `":" @@ Newline`
+	Name      string      `@Ident`
+	Type      *SchemaType `":" @@`
+	Reference string      `[ "@" @Ident ] Newline`
 }
 
 // A SchemaType specifies the type of a field.
@@ -7,28 +7,31 @@ import (
 	"github.com/alecthomas/participle/lexer"
 )
 
-var selectorLexer = lexer.Must(lexer.Regexp(`(?m)(\s+)` +
-	`|(?P<Ident>[\p{L}\p{M}_-][\p{L}\p{M}\d_-]*)` +
-	`|(?P<Number>\d+(?:\.\d+)?)` +
-	`|(?P<String>"(?:\\.|[^"])*"|'(?:\\.|[^'])*')` +
-	`|(?P<Regexp>/(?:\\.|[^/])+/)` +
-	`|(?P<Comparison>(?:=|!=|>=?|<=?|~))` +
-	`|(?P<Punctuation>[\.\[\]])`,
-))
-
 // SelectorParser parses query selectors.
 var SelectorParser *participle.Parser
 
+// UpdateParser parses the assignments used by update operations, which are
+// written in the same syntax as selectors.
+var UpdateParser *participle.Parser
+
 func init() {
+	SelectorParser = buildSelectorParser(&Selector{})
+	UpdateParser = buildSelectorParser(&SelectorUpdate{})
+}
+
+func buildSelectorParser(grammar interface{}) *participle.Parser {
 	parser, err := participle.Build(
-		&Selector{},
+		grammar,
 
 		participle.Lexer(selectorLexer),
 		participle.Unquote(selectorLexer, "String"),
 
 		participle.Map(func(token lexer.Token) lexer.Token {
-			if token.Type == lexer.DefaultDefinition.Symbols()["Regexp"] {
+			switch token.Type {
+			case selectorSymbols["Regexp"]:
 				token.Value = strings.Trim(token.Value, "/")
+			case selectorSymbols["Call"]:
+				token.Value = strings.TrimSuffix(token.Value, "(")
 			}
 			return token
 		}),
@@ -38,37 +41,177 @@ func init() {
 		panic(err)
 	}
 
-	SelectorParser = parser
+	return parser
 }
 
 // A Selector is used to query the database.
 type Selector struct {
-	Clauses []*SelectorClause `@@ { "." @@ }`
+	Call    *SelectorCall     `  @@`
+	Clauses []*SelectorClause `| @@ { @@ }`
 }
 
-// A SelectorClause is one part of a selector, for example "users[3]".
+// A SelectorCall calls a method on the result of another selector, for
+// example "count(todos[!completed])", which is the same as
+// "todos[!completed].count()".
+type SelectorCall struct {
+	Name     string    `@Call`
+	Selector *Selector `@@ ")"`
+}
+
+// A SelectorClause is one part of a selector, for example "users[3]" or
+// "sort(likes)". A clause can end with a projection, like "users{name, email}",
+// or be just a projection, like the last clause of "users[age > 30].{name, email}".
+//
+// Every clause except the first starts with a link, which says how it applies
+// to the result of the previous clause. "." gets a field of the result, ".."
+// gets that field of anything inside the result, at any depth, and "->" looks
+// up the result as an ID in a top-level list or hashmap, like
+// "users[5].post_ids->posts".
+//
+// Instead of the name of a field, "*" gets every field of a struct, or every
+// value of a hashmap.
 type SelectorClause struct {
-	Ident   string            `@Ident`
-	Filters []*SelectorFilter `{ "[" @@ "]" }`
+	Link       string              `[ @( "." | ".." | "->" ) ]`
+	Ident      string              `( ( @Ident`
+	Wildcard   bool                `  | @"*"`
+	Method     *SelectorMethod     `  | @@ )`
+	Filters    []*SelectorFilter   `  { "[" @@ "]" }`
+	Projection *SelectorProjection `  [ @@ ] | @@ )`
+}
+
+// A SelectorMethod calls a method on the result of the previous clause, for
+// example "sort(-likes, title)". The arguments are evaluated in the same way
+// as filters.
+type SelectorMethod struct {
+	Name string               `@Call`
+	Args []*SelectorCondition `[ @@ { "," @@ } ] ")"`
+}
+
+// A SelectorProjection lists the fields which should be kept from a struct,
+// or from each struct in a list or hashmap.
+type SelectorProjection struct {
+	Fields []string `"{" @Ident { "," @Ident } "}"`
 }
 
-// A SelectorFilter filters a clause based on either a literal key or a comparison.
+// A SelectorFilter filters a clause based on a condition. If the condition
+// doesn't refer to the item being filtered, e.g. "users[3]", it is used as a
+// key instead.
+//
+// If the filter contains a ":", e.g. "posts[2:10]", it is a slice instead.
+// The condition is the start of the slice, and either end can be omitted.
 type SelectorFilter struct {
-	Comparison *SelectorFilterComparison `  @@`
-	Index      *SelectorLiteral          `| @@`
+	Condition *SelectorCondition `[ @@ ]`
+	Slice     bool               `[ @":"`
+	End       *SelectorSum       `  [ @@ ] ]`
+}
+
+// A SelectorCondition is a set of alternatives separated by "|". It holds if
+// any of the alternatives hold.
+type SelectorCondition struct {
+	Or []*SelectorConjunction `@@ { "|" @@ }`
+}
+
+// A SelectorConjunction is a set of terms separated by "&". It holds if all
+// of the terms hold.
+type SelectorConjunction struct {
+	And []*SelectorTerm `@@ { "&" @@ }`
 }
 
-// A SelectorFilterComparison filters a clause based on whether an attribute of
-// a value is a certain thing.
+// A SelectorTerm is either a comparison or a negated term.
+type SelectorTerm struct {
+	Not        *SelectorTerm             `  "!" @@`
+	Comparison *SelectorFilterComparison `| @@`
+}
+
+// A SelectorFilterComparison compares two expressions. If the left hand side
+// is omitted, the item being filtered is compared, and if the comparison is
+// omitted, the left hand side is used as the result. As well as the usual
+// comparison operators, "in" checks whether a list contains the left hand side.
 type SelectorFilterComparison struct {
-	Ident      string           `[ @Ident ]`
-	Comparison string           `@Comparison`
-	Literal    *SelectorLiteral `@@`
+	Left       *SelectorSum `[ @@ ]`
+	Comparison string       `[ @( Comparison | "in" )`
+	Right      *SelectorSum `  @@ ]`
+}
+
+// A SelectorSum is a sequence of products separated by "+" or "-".
+type SelectorSum struct {
+	Left  *SelectorProduct      `@@`
+	Right []*SelectorSumOperand `{ @@ }`
 }
 
-// A SelectorLiteral is a literal value, like a string, number, or regexp.
+// A SelectorSumOperand is the right hand side of an addition or subtraction.
+type SelectorSumOperand struct {
+	Operator string           `@( "+" | "-" )`
+	Product  *SelectorProduct `@@`
+}
+
+// A SelectorProduct is a sequence of unary expressions separated by "*", "/"
+// or "%".
+type SelectorProduct struct {
+	Left  *SelectorUnary            `@@`
+	Right []*SelectorProductOperand `{ @@ }`
+}
+
+// A SelectorProductOperand is the right hand side of a multiplication,
+// division or modulo.
+type SelectorProductOperand struct {
+	Operator string         `@( "*" | "/" | "%" )`
+	Unary    *SelectorUnary `@@`
+}
+
+// A SelectorUnary is a value, which is optionally negated with "-", or with
+// "!" if it's a bool, e.g. "completed = !completed".
+type SelectorUnary struct {
+	Negate bool           `[ @"-"`
+	Not    bool           `| @"!" ]`
+	Value  *SelectorValue `@@`
+}
+
+// A SelectorValue is a literal, a function call, a reference to a field of the
+// item being filtered, a variable, or a parenthesised condition.
+type SelectorValue struct {
+	Literal  *SelectorLiteral   `  @@`
+	Function *SelectorFunction  `| @@`
+	Field    *string            `| @Ident`
+	Variable *string            `| @Variable`
+	Group    *SelectorCondition `| "(" @@ ")"`
+}
+
+// A SelectorFunction calls one of the functions which can be used in filters,
+// for example "len(friends)".
+type SelectorFunction struct {
+	Name string               `@Call`
+	Args []*SelectorCondition `[ @@ { "," @@ } ] ")"`
+}
+
+// A SelectorLiteral is a literal value, like a string, number, regexp, bool,
+// null, or a list of other literals. Numbers can be negative, and written in
+// scientific notation, like "-1.5e3".
 type SelectorLiteral struct {
-	String *string  `  @String`
-	Number *float64 `| @Number`
-	Regexp *string  `| @Regexp`
+	String *string       `  @String`
+	Number *string       `| @( [ "-" ] Number )`
+	Regexp *string       `| @Regexp`
+	Bool   *string       `| @( "true" | "false" )`
+	Null   bool          `| @"null"`
+	List   *SelectorList `| @@`
+}
+
+// A SelectorList is a list literal, like "[18, 21, 30]".
+type SelectorList struct {
+	Elements []*SelectorLiteral `"[" [ @@ { "," @@ } ] "]"`
+}
+
+// A SelectorUpdate is a list of assignments, like "likes += 1, seen = true",
+// which an update operation applies to each of the elements it selects.
+type SelectorUpdate struct {
+	Assignments []*SelectorAssignment `@@ { "," @@ }`
+}
+
+// A SelectorAssignment sets a field to the value of an expression, which can
+// refer to the element's other fields. "likes += 1" is the same as
+// "likes = likes + 1".
+type SelectorAssignment struct {
+	Field    string       `@Ident`
+	Operator string       `[ @( "+" | "-" | "*" | "/" | "%" ) ] "="`
+	Value    *SelectorSum `@@`
 }
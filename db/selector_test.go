@@ -0,0 +1,622 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+func lexSelector(t *testing.T, selector string) []string {
+	tokens, err := lexer.ConsumeAll(selectorLexer.Lex(strings.NewReader(selector)))
+	if err != nil {
+		t.Fatalf("%s: %s", selector, err)
+	}
+
+	names := lexer.SymbolsByRune(selectorLexer)
+	var out []string
+
+	for _, token := range tokens {
+		if token.EOF() {
+			break
+		}
+
+		out = append(out, names[token.Type]+" "+token.Value)
+	}
+
+	return out
+}
+
+func TestSelectorLexer(t *testing.T) {
+	cases := []struct {
+		selector string
+		tokens   []string
+	}{
+		{"first-name", []string{"Ident first-name"}},
+		{"likes-1", []string{"Ident likes", "Punctuation -", "Number 1"}},
+		{"a-_b", []string{"Ident a", "Punctuation -", "Ident _b"}},
+		{"likes/2 > likes/3", []string{
+			"Ident likes", "Punctuation /", "Number 2", "Comparison >",
+			"Ident likes", "Punctuation /", "Number 3",
+		}},
+		{"(a)/b/c", []string{
+			"Punctuation (", "Ident a", "Punctuation )", "Punctuation /",
+			"Ident b", "Punctuation /", "Ident c",
+		}},
+		{"name ~ /a b/", []string{"Ident name", "Comparison ~", "Regexp /a b/"}},
+		{"/x/", []string{"Regexp /x/"}},
+		{"tags in [/a/, /b/]", []string{
+			"Ident tags", "Ident in", "Punctuation [", "Regexp /a/",
+			"Punctuation ,", "Regexp /b/", "Punctuation ]",
+		}},
+		{"contains(name, /a/)", []string{
+			"Call contains(", "Ident name", "Punctuation ,", "Regexp /a/", "Punctuation )",
+		}},
+	}
+
+	for _, c := range cases {
+		if got := lexSelector(t, c.selector); !reflect.DeepEqual(got, c.tokens) {
+			t.Errorf("%s: got %q, want %q", c.selector, got, c.tokens)
+		}
+	}
+}
+
+func TestSelectorParser(t *testing.T) {
+	valid := []string{
+		"users",
+		"users[first-name = 'a']",
+		"posts[likes-1 > 5]",
+		"posts[likes/2 > likes/3]",
+		"posts[(likes)/2 > 1]",
+		"users[name ~ /^a/]",
+		"users[age in [18, 21, 30]]",
+		"users[contains(name, /a/)]",
+		"posts.sort(-likes, title)",
+	}
+
+	for _, sel := range valid {
+		s := &Selector{}
+		if err := SelectorParser.ParseString(sel, s); err != nil {
+			t.Errorf("%s: %s", sel, err)
+		}
+	}
+
+	s := &Selector{}
+	if err := SelectorParser.ParseString("posts[likes/2 > likes/3]", s); err != nil {
+		t.Fatal(err)
+	}
+
+	cmp := s.Clauses[0].Filters[0].Condition.Or[0].And[0].Comparison
+	if cmp.Comparison != ">" {
+		t.Fatalf("got comparison %q, want >", cmp.Comparison)
+	}
+
+	for _, side := range []*SelectorSum{cmp.Left, cmp.Right} {
+		product := side.Left
+		if len(product.Right) != 1 || product.Right[0].Operator != "/" {
+			t.Errorf("expected a division, got %+v", product)
+		}
+	}
+
+	u := &SelectorUpdate{}
+	if err := UpdateParser.ParseString("likes /= 2, score = likes-1", u); err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Assignments[0].Operator != "/" {
+		t.Errorf("got operator %q, want /", u.Assignments[0].Operator)
+	}
+
+	if sum := u.Assignments[1].Value; len(sum.Right) != 1 || sum.Right[0].Operator != "-" {
+		t.Errorf("expected a subtraction, got %+v", sum)
+	}
+
+	if err := UpdateParser.ParseString("completed = !completed", u); err != nil {
+		t.Fatal(err)
+	}
+
+	if unary := u.Assignments[0].Value.Left.Left; !unary.Not {
+		t.Errorf("expected a negation, got %+v", unary)
+	}
+}
+
+const queryTestSchema = `
+posts: <int:post>
+users: [user]
+scores: <string:int>
+nums: [int]
+
+struct post {
+    title: string
+    likes: int
+    tags: [string]
+}
+
+struct user {
+    name: string
+    age: int
+    email: string
+    admin: bool
+    post_ids: [int] @posts
+}`
+
+// openQueryTestDB makes a database with the queryTestSchema, and a few posts,
+// users, scores and nums.
+func openQueryTestDB(t *testing.T) *DB {
+	d, err := OpenString(queryTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{
+		"posts": {
+			"1": {"title": "hello", "likes": 10, "tags": ["go", "db"]},
+			"2": {"title": "world", "likes": 3, "tags": ["go"]},
+			"3": {"title": "again", "likes": 7, "tags": []}
+		},
+		"users": [
+			{"name": "ann", "age": 30, "email": "ann@example.com", "admin": true, "post_ids": [1, 2]},
+			{"name": "bob", "age": 25, "email": "", "admin": false, "post_ids": [3]},
+			{"name": "cid", "age": 41, "email": "cid@example.com", "admin": false, "post_ids": []}
+		],
+		"scores": {"a": 1, "b": 2},
+		"nums": [5, 3, 8, 1]
+	}`
+
+	var fields map[string]interface{}
+	if err := DecodeJSON([]byte(data), &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, val := range fields {
+		if err := d.Apply(&Operation{Action: ActionSet, Selector: name, Payload: val}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return d
+}
+
+// A queryCase is a selector, and either the JSON of its result, or part of the
+// error it should fail with.
+type queryCase struct {
+	selector, want, err string
+}
+
+func testQueries(t *testing.T, d *DB, params Params, cases []queryCase) {
+	for _, c := range cases {
+		res, err := d.QueryStringWithParams(c.selector, params)
+
+		if c.err != "" {
+			if err == nil {
+				t.Errorf("%s: expected an error containing %q, but got %s", c.selector, c.err, res.JSON())
+			} else if !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected an error containing %q, but got %q", c.selector, c.err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", c.selector, err)
+		} else if got := res.JSON(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.selector, got, c.want)
+		}
+	}
+}
+
+// applyCase is an operation which is expected to fail with an error containing
+// err.
+type applyCase struct {
+	op  *Operation
+	err string
+}
+
+func testApplyErrors(t *testing.T, d *DB, cases []applyCase) {
+	for _, c := range cases {
+		if err := d.Apply(c.op); err == nil {
+			t.Errorf("%s %s: expected an error containing %q", c.op.Action, c.op.Selector, c.err)
+		} else if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s %s: expected an error containing %q, but got %q", c.op.Action, c.op.Selector, c.err, err)
+		}
+	}
+}
+
+func TestIndexesAndSlices(t *testing.T) {
+	testQueries(t, openQueryTestDB(t), Params{"i": NewInt(-1), "f": NewFloat(0.5)}, []queryCase{
+		{selector: "nums[0]", want: "5"},
+		{selector: "nums[-1]", want: "1"},
+		{selector: "nums[$i]", want: "1"},
+		{selector: "nums[1e0]", want: "3"},
+		{selector: "nums[1:3]", want: "[3, 8]"},
+		{selector: "nums[:2]", want: "[5, 3]"},
+		{selector: "nums[-2:]", want: "[8, 1]"},
+		{selector: "nums[2:1]", want: "[]"},
+		{selector: "nums[-99:99]", want: "[5, 3, 8, 1]"},
+		{selector: "nums[:99999999999999999999]", err: "integer"},
+		{selector: "nums[4]", err: "index out of bounds"},
+		{selector: "nums[-5]", err: "index out of bounds"},
+		{selector: "nums[-9223372036854775808]", err: "index out of bounds"},
+		{selector: "nums[1.5]", err: "can only index a list with an integer"},
+		{selector: "nums[$f]", err: "can only index a list with an integer"},
+		{selector: "nums[0.9:2]", err: "can only slice a list with an integer"},
+		{selector: "nums[:2.5]", err: "can only slice a list with an integer"},
+		{selector: "nums['a']", err: "can only index a list with a numeric type"},
+		{selector: "nums['a':]", err: "can only slice a list with a numeric type"},
+		{selector: "nums[age:]", err: "the start of a slice cannot refer to a field"},
+		{selector: "scores[1:2]", err: "slice"},
+	})
+}
+
+func TestProjections(t *testing.T) {
+	testQueries(t, openQueryTestDB(t), nil, []queryCase{
+		{selector: "users[age > 29].{name, email}", want: `[{"email": "ann@example.com", "name": "ann"}, {"email": "cid@example.com", "name": "cid"}]`},
+		{selector: "users[age > 29]{name, email}", want: `[{"email": "ann@example.com", "name": "ann"}, {"email": "cid@example.com", "name": "cid"}]`},
+		{selector: "users{name}", want: `[{"name": "ann"}, {"name": "bob"}, {"name": "cid"}]`},
+		{selector: "users{name}.name", want: `["ann", "bob", "cid"]`},
+		{selector: "users[0]{name, age}", want: `{"age": 30, "name": "ann"}`},
+		{selector: "posts{title}", want: `{"1": {"title": "hello"}, "2": {"title": "world"}, "3": {"title": "again"}}`},
+		{selector: "posts[likes > 5]{title, likes}", want: `{"1": {"likes": 10, "title": "hello"}, "3": {"likes": 7, "title": "again"}}`},
+		{selector: "{nums, scores}", want: `{"nums": [5, 3, 8, 1], "scores": {"a": 1, "b": 2}}`},
+		{selector: "users{nope}", err: "cannot project undefined field nope"},
+		{selector: "nums{a}", err: "cannot project a int"},
+		{selector: "scores{a}", err: "cannot project a int"},
+		{selector: "users{}", err: "unexpected"},
+	})
+}
+
+func TestSort(t *testing.T) {
+	testQueries(t, openQueryTestDB(t), nil, []queryCase{
+		{selector: "nums.sort()", want: "[1, 3, 5, 8]"},
+		{selector: "scores.sort()", want: "[1, 2]"},
+		{selector: "users.sort(-age).name", want: `["cid", "ann", "bob"]`},
+		{selector: "users.sort(-name).name", want: `["cid", "bob", "ann"]`},
+		{selector: "users.sort(email, name).name", want: `["bob", "ann", "cid"]`},
+		{selector: "posts.sort(likes).title", want: `["world", "again", "hello"]`},
+		{selector: "posts.sort(-likes)[:2].title", want: `["hello", "again"]`},
+		{selector: "posts.sort(len(tags) > 0, -likes).title", want: `["again", "hello", "world"]`},
+
+		// false comes before true, and equal elements keep their order
+		{selector: `users.sort(email = "").name`, want: `["ann", "cid", "bob"]`},
+		{selector: "users.sort(len(post_ids) > 0).name", want: `["cid", "ann", "bob"]`},
+
+		{selector: "users.sort()", err: "compare not supported"},
+		{selector: "users.sort(post_ids)", err: "compare not supported"},
+		{selector: "users.sort(nope)", err: "cannot retrieve undefined field nope"},
+		{selector: "scores.sort(nope)", err: "getfield not supported"},
+		{selector: "users[0].sort()", err: "expected a list or hashmap"},
+	})
+}
+
+func TestAggregates(t *testing.T) {
+	testQueries(t, openQueryTestDB(t), nil, []queryCase{
+		{selector: "count(users)", want: "3"},
+		{selector: "users.count()", want: "3"},
+		{selector: "count(users[age > 29])", want: "2"},
+		{selector: "count(users[age > 99])", want: "0"},
+		{selector: "count(scores)", want: "2"},
+		{selector: "sum(nums)", want: "17"},
+		{selector: "nums.sum()", want: "17"},
+		{selector: "scores.sum()", want: "3"},
+		{selector: "posts.sum(likes)", want: "20"},
+		{selector: "sum(users[age > 99].age)", want: "0"},
+		{selector: "avg(nums)", want: "4.25"},
+		{selector: "users.avg(age)", want: "32"},
+		{selector: "max(nums)", want: "8"},
+		{selector: "nums.min()", want: "1"},
+		{selector: "min(scores)", want: "1"},
+		{selector: "min(users.age)", want: "25"},
+		{selector: "users.max(age)", want: "41"},
+		{selector: "posts.max(likes)", want: "10"},
+		{selector: "max(users.name)", want: `"cid"`},
+		{selector: "users.min(name)", want: `"ann"`},
+
+		{selector: "avg(users[age > 99].age)", err: "cannot take the average of nothing"},
+		{selector: "max(users[age > 99].age)", err: "cannot take the max of nothing"},
+		{selector: "sum(users.name)", err: "cannot add a string"},
+		{selector: "users.sum(name)", err: "cannot add a string"},
+		{selector: "sum(users)", err: "cannot add a (struct) user"},
+		{selector: "max(users)", err: "compare not supported"},
+		{selector: "users[0].count()", err: "expected a list or hashmap"},
+		{selector: "users[count(post_ids) > 0]", err: "undefined function count"},
+		{selector: "count(nums, 1)", err: "unexpected"},
+	})
+}
+
+func TestFieldMapping(t *testing.T) {
+	d := openQueryTestDB(t)
+
+	testQueries(t, d, nil, []queryCase{
+		{selector: "users.name", want: `["ann", "bob", "cid"]`},
+		{selector: "users[age > 29].name", want: `["ann", "cid"]`},
+		{selector: "users[age > 99].name", want: "[]"},
+		{selector: "users.age[> 29]", want: "[30, 41]"},
+		{selector: "users.name[0]", want: `"ann"`},
+		{selector: "posts.title", want: `["hello", "world", "again"]`},
+		{selector: "posts[likes > 5].title", want: `["hello", "again"]`},
+		{selector: "sum(posts.likes)", want: "20"},
+
+		// lists of lists are flattened
+		{selector: "users.post_ids", want: "[1, 2, 3]"},
+		{selector: "posts.tags", want: `["go", "db", "go"]`},
+		{selector: `posts.tags[= "go"]`, want: `["go", "go"]`},
+
+		// a hashmap with string keys gets the key instead
+		{selector: "scores.a", want: "1"},
+		{selector: "scores.c", err: `key "c" does not exist`},
+
+		{selector: "users.nope", err: "cannot retrieve undefined field nope"},
+		{selector: "users[age > 99].nope", err: "cannot retrieve undefined field nope"},
+		{selector: "nums.x", err: "getfield not supported"},
+		{selector: "users.post_ids.x", err: "getfield not supported"},
+	})
+
+	testApplyErrors(t, d, []applyCase{
+		{&Operation{Action: ActionSet, Selector: "users.name", Payload: "x"}, "cannot modify a field of every element"},
+		{&Operation{Action: ActionSet, Selector: "users[age > 29].email", Payload: "x"}, "cannot modify a field of every element"},
+		{&Operation{Action: ActionAppend, Selector: "posts.tags", Payload: "x"}, "cannot modify a field of every element"},
+		{&Operation{Action: ActionSet, Selector: "users{name}", Payload: []interface{}{}}, "only fields, keys, filters, slices and -> can select what to modify"},
+		{&Operation{Action: ActionSet, Selector: "users..name", Payload: "x"}, "only fields, keys, filters, slices and -> can select what to modify"},
+		{&Operation{Action: ActionSet, Selector: "users.sort(age)", Payload: []interface{}{}}, "only fields, keys, filters, slices and -> can select what to modify"},
+		{&Operation{Action: ActionSet, Selector: "count(users)", Payload: json.Number("1")}, "cannot modify the result of a method"},
+	})
+
+	// a field of a single element, or a key of a hashmap, can be modified
+	mustApply(t, d,
+		&Operation{Action: ActionSet, Selector: "users[1].email", Payload: "bob@example.com"},
+		&Operation{Action: ActionSet, Selector: "scores.a", Payload: json.Number("5")},
+	)
+
+	testQueries(t, d, nil, []queryCase{
+		{selector: "users.email", want: `["ann@example.com", "bob@example.com", "cid@example.com"]`},
+		{selector: "posts.tags", want: `["go", "db", "go"]`},
+		{selector: "scores", want: `{"a": 5, "b": 2}`},
+	})
+}
+
+func TestReferences(t *testing.T) {
+	d := openQueryTestDB(t)
+
+	testQueries(t, d, nil, []queryCase{
+		{selector: "users[0].post_ids->posts.title", want: `["hello", "world"]`},
+		{selector: "users[0].post_ids[0]->posts.title", want: `"hello"`},
+		{selector: "users[1].post_ids->posts", want: `[{"likes": 7, "tags": [], "title": "again"}]`},
+		{selector: "users[2].post_ids->posts", want: "[]"},
+		{selector: "users.post_ids->posts.likes", want: "[10, 3, 7]"},
+		{selector: "users[0].post_ids->posts[likes > 5]{title}", want: `[{"title": "hello"}]`},
+		{selector: "count(users[0].post_ids->posts)", want: "2"},
+
+		// IDs can index a list too
+		{selector: "users[0].post_ids->users.name", want: `["bob", "cid"]`},
+
+		{selector: "users[0].post_ids->nope", err: "cannot retrieve undefined field nope"},
+		{selector: "users[0].post_ids->scores", err: "key type is string, but a key of type int was requested"},
+		{selector: "users[0].name->posts", err: "key type is int, but a key of type string was requested"},
+		{selector: "users->posts", err: "key type is int, but a key of type (struct) user was requested"},
+		{selector: "->posts", err: "a selector cannot start with ->"},
+	})
+
+	// references aren't checked unless CheckReferences is set
+	mustApply(t, d, &Operation{Action: ActionAppend, Selector: "users[2].post_ids", Payload: json.Number("9")})
+
+	testQueries(t, d, nil, []queryCase{
+		{selector: "users[2].post_ids->posts", err: "does not exist"},
+	})
+
+	mustApply(t, d, &Operation{Action: ActionEmpty, Selector: "users[2].post_ids"})
+
+	d.CheckReferences = true
+
+	testApplyErrors(t, d, []applyCase{
+		{&Operation{Action: ActionAppend, Selector: "users[0].post_ids", Payload: json.Number("9")}, "does not exist"},
+		{&Operation{Action: ActionSet, Selector: "users[1].post_ids[0]", Payload: json.Number("4")}, "does not exist"},
+		{&Operation{Action: ActionUnset, Selector: "posts", Payload: json.Number("3")}, "does not exist"},
+		{&Operation{Action: ActionTransaction, Operations: []*Operation{
+			{Action: ActionKey, Selector: "posts", Payload: map[string]interface{}{"key": json.Number("4"), "value": map[string]interface{}{"title": "new", "likes": json.Number("0"), "tags": []interface{}{}}}},
+			{Action: ActionAppend, Selector: "users[2].post_ids", Payload: json.Number("5")},
+		}}, "does not exist"},
+	})
+
+	// broken references are rolled back
+	testQueries(t, d, nil, []queryCase{
+		{selector: "users.post_ids", want: "[1, 2, 3]"},
+		{selector: "posts.title", want: `["hello", "world", "again"]`},
+	})
+
+	// a post can be removed in the same transaction as the IDs which refer to
+	// it, and new posts can be referred to straight away
+	mustApply(t, d,
+		&Operation{Action: ActionTransaction, Operations: []*Operation{
+			{Action: ActionEmpty, Selector: "users[1].post_ids"},
+			{Action: ActionUnset, Selector: "posts", Payload: json.Number("3")},
+		}},
+		&Operation{Action: ActionKey, Selector: "posts", Payload: map[string]interface{}{"key": json.Number("4"), "value": map[string]interface{}{"title": "new", "likes": json.Number("0"), "tags": []interface{}{}}}},
+		&Operation{Action: ActionAppend, Selector: "users[2].post_ids", Payload: json.Number("4")},
+	)
+
+	testQueries(t, d, nil, []queryCase{
+		{selector: "users.post_ids->posts.title", want: `["hello", "world", "new"]`},
+	})
+
+	if _, err := OpenString("a: int @b\nb: int\n", ""); err == nil {
+		t.Error("expected an error referring to a field which isn't a list or hashmap")
+	}
+}
+
+const descentTestSchema = `
+me: user
+labels: <string:string>
+nums: [int]
+
+struct user {
+    name: string
+    age: int
+    friends: [user]
+}
+`
+
+// friendOf returns a user whose only friend is the given one.
+func friendOf(friend map[string]interface{}) map[string]interface{} {
+	friends := []interface{}{}
+	if friend != nil {
+		friends = append(friends, friend)
+	}
+
+	return map[string]interface{}{"name": "z", "age": json.Number("0"), "friends": friends}
+}
+
+func TestDescentAndWildcards(t *testing.T) {
+	d, err := OpenString(descentTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{
+		"me": {"name": "a", "age": 1, "friends": [
+			{"name": "b", "age": 2, "friends": [
+				{"name": "c", "age": 3, "friends": []}
+			]},
+			{"name": "d", "age": 4, "friends": []}
+		]},
+		"labels": {"name": "m", "x": "y"},
+		"nums": [1, 2]
+	}`
+
+	var fields map[string]interface{}
+	if err := DecodeJSON([]byte(data), &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, val := range fields {
+		mustApply(t, d, &Operation{Action: ActionSet, Selector: name, Payload: val})
+	}
+
+	testQueries(t, d, nil, []queryCase{
+		{selector: "me..name", want: `["a", "b", "c", "d"]`},
+		{selector: "me.friends..name", want: `["b", "c", "d"]`},
+		{selector: "me..age[> 1]", want: "[2, 3, 4]"},
+		{selector: "sum(me..age)", want: "10"},
+		{selector: "me..nope", want: "[]"},
+		{selector: "..name", want: `["m", "a", "b", "c", "d"]`},
+		{selector: "count(me..*)", want: "15"},
+		{selector: "me.*", want: `[1, [{"age": 2, "friends": [{"age": 3, "friends": [], "name": "c"}], "name": "b"}, {"age": 4, "friends": [], "name": "d"}], "a"]`},
+		{selector: "me.friends.*[0]", want: "2"},
+		{selector: "labels.*", want: `["m", "y"]`},
+		{selector: "*[2]", want: "[1, 2]"},
+
+		{selector: "me..count()", err: ".. must be followed by the name of a field or *"},
+		{selector: "me..{name}", err: ".. must be followed by the name of a field or *"},
+		{selector: "nums[0].*", err: "cannot use * on a int"},
+	})
+
+	testApplyErrors(t, d, []applyCase{
+		{&Operation{Action: ActionSet, Selector: "*", Payload: json.Number("1")}, "only fields, keys, filters, slices and -> can select what to modify"},
+		{&Operation{Action: ActionSet, Selector: "me..age", Payload: json.Number("1")}, "only fields, keys, filters, slices and -> can select what to modify"},
+	})
+
+	// ".." gives up past 64 levels, but not before
+	shallow, deep := friendOf(nil), friendOf(nil)
+	for i := 0; i < 20; i++ {
+		shallow = friendOf(shallow)
+	}
+
+	for i := 0; i < 40; i++ {
+		deep = friendOf(deep)
+	}
+
+	mustApply(t, d, &Operation{Action: ActionSet, Selector: "me", Payload: shallow})
+	testQueries(t, d, nil, []queryCase{{selector: "count(me..name)", want: "21"}})
+
+	mustApply(t, d, &Operation{Action: ActionSet, Selector: "me", Payload: deep})
+	testQueries(t, d, nil, []queryCase{{selector: "me..name", err: "cannot search more than 64 levels deep"}})
+}
+
+func TestLiterals(t *testing.T) {
+	testQueries(t, openQueryTestDB(t), Params{"ages": NewList(&IntType{})}, []queryCase{
+		{selector: "users[admin = true].name", want: `["ann"]`},
+		{selector: "users[admin=false].name", want: `["bob", "cid"]`},
+		{selector: "users[admin != true].name", want: `["bob", "cid"]`},
+		{selector: "users[(age > 26) = true].name", want: `["ann", "cid"]`},
+		{selector: "nums[> -1]", want: "[5, 3, 8, 1]"},
+		{selector: "nums[< -0]", want: "[]"},
+		{selector: "nums[= -(-5)]", want: "[5]"},
+		{selector: "nums[= 5e0]", want: "[5]"},
+		{selector: "nums[> 1.5e0]", want: "[5, 3, 8]"},
+		{selector: "posts[likes > 5E-1].title", want: `["hello", "world", "again"]`},
+		{selector: "users[age in [25, 41]].name", want: `["bob", "cid"]`},
+		{selector: "users[age in [1, 2]].name", want: "[]"},
+		{selector: `users[name in ["ann"]].name`, want: `["ann"]`},
+		{selector: "users[!(age in [])].name", want: `["ann", "bob", "cid"]`},
+		{selector: "users[age in $ages].name", want: "[]"},
+
+		// a missing field is null
+		{selector: "users[nope = null].name", want: `["ann", "bob", "cid"]`},
+		{selector: "users[null = nope].name", want: `["ann", "bob", "cid"]`},
+		{selector: "users[nope != null].name", want: "[]"},
+		{selector: "users[email = null].name", want: "[]"},
+		{selector: "users[email != null].name", want: `["ann", "bob", "cid"]`},
+
+		{selector: "users[age in 5]", err: "the right hand argument to in must be a list, but got a int"},
+		{selector: "users[age < null]", err: "only = and != are supported on null"},
+		{selector: "users[age < true]", err: "can only compare ints with numeric types"},
+		{selector: "nums[= [5]]", err: "can only compare ints with numeric types"},
+		{selector: "users[age in [1, 2]", err: "unexpected"},
+		{selector: "nums[= 1e]", err: "unexpected"},
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	d := openQueryTestDB(t)
+
+	updates := []struct {
+		selector string
+		params   map[string]interface{}
+		update   interface{}
+	}{
+		{"users[!admin]", nil, map[string]interface{}{"email": "x@example.com"}},
+		{"posts[likes < 8]", nil, "likes += 1"},
+		{"users", nil, "name = upper(name), age = age + 1"},
+		{"users[0]", nil, "admin = !admin"},
+		{"users[name = $n]", map[string]interface{}{"n": "CID"}, "age = 0"},
+
+		// every value is worked out before any fields are set
+		{"users[1]", nil, "email = name, name = email"},
+	}
+
+	for _, u := range updates {
+		if err := d.Update(u.selector, u.params, u.update); err != nil {
+			t.Fatalf("%s %v: %s", u.selector, u.update, err)
+		}
+	}
+
+	want := []queryCase{
+		{selector: "users.name", want: `["ANN", "x@example.com", "CID"]`},
+		{selector: "users.email", want: `["ann@example.com", "BOB", "x@example.com"]`},
+		{selector: "users.age", want: "[31, 26, 0]"},
+		{selector: "users.admin", want: "[false, false, false]"},
+		{selector: "posts.likes", want: "[10, 4, 8]"},
+	}
+
+	testQueries(t, d, nil, want)
+
+	testApplyErrors(t, d, []applyCase{
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: json.Number("5")}, "expected an object of fields to set, or a string of assignments"},
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: "age +"}, "unexpected"},
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: "nope = 1"}, "cannot retrieve undefined field nope"},
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: map[string]interface{}{"nope": json.Number("1")}}, "cannot retrieve undefined field nope"},
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: map[string]interface{}{"age": "x"}}, "expected an integer value"},
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: "age = 'x'"}, "expected an integer value"},
+		{&Operation{Action: ActionUpdate, Selector: "nums", Payload: "x = 1"}, "getfield not supported"},
+		{&Operation{Action: ActionUpdate, Selector: "scores", Payload: map[string]interface{}{"c": json.Number("1")}}, "getfield not supported"},
+		{&Operation{Action: ActionUpdate, Selector: "users[0].name", Payload: "x = 1"}, "getfield not supported"},
+		{&Operation{Action: ActionUpdate, Selector: "users.name", Payload: "x = 1"}, "cannot modify a field of every element"},
+
+		// the first user can be updated, but not the second
+		{&Operation{Action: ActionUpdate, Selector: "users", Payload: "email = name, age = 30 / (age - 26)"}, "division by zero"},
+	})
+
+	// none of the failed updates changed anything
+	testQueries(t, d, nil, want)
+}
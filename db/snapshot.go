@@ -0,0 +1,122 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SnapshotFile is the name of the file, inside a data directory, which the
+// latest snapshot is stored in.
+const SnapshotFile = "snapshot.json"
+
+// WriteSnapshot writes the entire contents of the database to w, as JSON,
+// along with the sequence number of the last operation applied to it.
+func (d *DB) WriteSnapshot(w io.Writer) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.writeSnapshot(w)
+}
+
+func (d *DB) writeSnapshot(w io.Writer) (err error) {
+	_, err = fmt.Fprintf(w, `{"seq": %d, "data": %s}`, d.seq, d.data.JSON())
+	return err
+}
+
+// ReadSnapshot replaces the contents of the database with a snapshot read
+// from r. The snapshot is checked against the schema as it is loaded, and the
+// database is left untouched if it doesn't match.
+func (d *DB) ReadSnapshot(r io.Reader) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.readSnapshot(r)
+}
+
+func (d *DB) readSnapshot(r io.Reader) (err error) {
+	snapshot := struct {
+		Seq  uint64      `json:"seq"`
+		Data interface{} `json:"data"`
+	}{}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	if err := dec.Decode(&snapshot); err != nil {
+		return newError(ErrUnknown, "could not decode snapshot: %s", err.Error())
+	}
+
+	data := NewStruct(d.data.ty)
+	if err := data.Set(snapshot.Data); err != nil {
+		return err
+	}
+
+	d.data = data
+	d.seq = snapshot.Seq
+
+	return nil
+}
+
+// SaveSnapshot writes a snapshot of the database to the data directory dir.
+// The snapshot is written to a temporary file first, so a crash part of the
+// way through won't corrupt the previous snapshot.
+func (d *DB) SaveSnapshot(dir string) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.saveSnapshot(dir)
+}
+
+func (d *DB) saveSnapshot(dir string) (err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, SnapshotFile)
+
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadSnapshot loads the latest snapshot from the data directory dir. If
+// there is no snapshot yet, the database is left as it is.
+func (d *DB) LoadSnapshot(dir string) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.loadSnapshot(dir)
+}
+
+func (d *DB) loadSnapshot(dir string) (err error) {
+	f, err := os.Open(filepath.Join(dir, SnapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return d.readSnapshot(f)
+}
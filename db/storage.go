@@ -0,0 +1,77 @@
+package db
+
+import "os"
+
+// Restore loads the contents of the database from the data directory dir, by
+// loading the latest snapshot and replaying the log on top of it. From then
+// on, every operation passed to Apply is written to the log.
+func (d *DB) Restore(dir string) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := d.loadSnapshot(dir); err != nil {
+		return err
+	}
+
+	err = ReadLog(dir, func(op *Operation) error {
+		// operations up to d.seq are already part of the snapshot
+		if op.Seq <= d.seq {
+			return nil
+		}
+
+		if err := d.apply(op); err != nil {
+			return err
+		}
+
+		d.seq = op.Seq
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	log, err := OpenLog(dir)
+	if err != nil {
+		return err
+	}
+
+	d.log = log
+	d.dir = dir
+
+	return nil
+}
+
+// Compact saves a new snapshot to the data directory and then empties the
+// log, since every operation in it is now part of the snapshot.
+func (d *DB) Compact() (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.log == nil {
+		return newError(ErrNOOP, "the database has not been restored from a data directory")
+	}
+
+	if err := d.saveSnapshot(d.dir); err != nil {
+		return err
+	}
+
+	return d.log.Truncate()
+}
+
+// Close closes the database's log, if it has one.
+func (d *DB) Close() (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.log == nil {
+		return nil
+	}
+
+	return d.log.Close()
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const storageTestSchema = `
+nums: [int]
+names: <string:int>
+total: int
+`
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "siphon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func mustApply(t *testing.T, d *DB, ops ...*Operation) {
+	for _, op := range ops {
+		if err := d.Apply(op); err != nil {
+			t.Fatalf("%s %s: %s", op.Action, op.Selector, err)
+		}
+	}
+}
+
+func expectJSON(t *testing.T, d *DB, want map[string]string) {
+	for sel, w := range want {
+		res, err := d.QueryString(sel)
+		if err != nil {
+			t.Errorf("%s: %s", sel, err)
+			continue
+		}
+
+		if got := res.JSON(); got != w {
+			t.Errorf("%s: got %s, want %s", sel, got, w)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	d, err := OpenString(storageTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d,
+		&Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("1")},
+		&Operation{Action: ActionKey, Selector: "names", Payload: map[string]interface{}{"key": "a", "value": json.Number("2")}},
+		&Operation{Action: ActionIncr, Selector: "total"},
+	)
+
+	buf := &bytes.Buffer{}
+	if err := d.WriteSnapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenString(storageTestSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.ReadSnapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.seq != 3 {
+		t.Errorf("got seq %d, want 3", restored.seq)
+	}
+
+	expectJSON(t, restored, map[string]string{
+		"nums":  "[1]",
+		"names": `{"a": 2}`,
+		"total": "1",
+	})
+
+	// a snapshot which doesn't match the schema leaves the database as it was
+	if err := restored.ReadSnapshot(bytes.NewBufferString(`{"seq": 9, "data": {"nums": "x"}}`)); err == nil {
+		t.Error("expected an error reading an invalid snapshot")
+	}
+
+	if restored.seq != 3 {
+		t.Errorf("got seq %d after an invalid snapshot, want 3", restored.seq)
+	}
+
+	expectJSON(t, restored, map[string]string{"nums": "[1]"})
+}
+
+func TestCompactAndReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d,
+		&Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("1")},
+		&Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("2")},
+	)
+
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, LogFile))
+	if err != nil {
+		t.Fatal(err)
+	} else if info.Size() != 0 {
+		t.Errorf("the log is %d bytes after compacting, want 0", info.Size())
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if restored.seq != 2 {
+		t.Errorf("got seq %d, want 2", restored.seq)
+	}
+
+	expectJSON(t, restored, map[string]string{"nums": "[1, 2]"})
+
+	// the sequence carries on from the snapshot
+	op := &Operation{Action: ActionIncr, Selector: "total"}
+	mustApply(t, restored, op)
+
+	if op.Seq != 3 {
+		t.Errorf("got seq %d for the next operation, want 3", op.Seq)
+	}
+}
+
+func TestSnapshotLeftoverTempFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d, &Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("1")})
+
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a snapshot which was never renamed into place, e.g. because of a crash
+	tmp := filepath.Join(dir, SnapshotFile+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(`{"seq": 7, "data": {"nums": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if restored.seq != 1 {
+		t.Errorf("got seq %d, want 1", restored.seq)
+	}
+
+	expectJSON(t, restored, map[string]string{"nums": "[1]"})
+
+	// the next snapshot replaces the leftover one
+	mustApply(t, restored, &Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("2")})
+
+	if err := restored.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected %s to have been renamed, but got %v", tmp, err)
+	}
+
+	again, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+
+	expectJSON(t, again, map[string]string{"nums": "[1, 2]"})
+}
+
+func TestRestoreReplaysLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d, &Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("1")})
+
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d,
+		&Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("9007199254740993")},
+		&Operation{Action: ActionKey, Selector: "names", Payload: map[string]interface{}{"key": "a", "value": json.Number("-9223372036854775808")}},
+		&Operation{Action: ActionIncr, Selector: "total", Payload: json.Number("5")},
+		&Operation{Action: ActionUpdate, Selector: "nums", Payload: map[string]interface{}{}},
+	)
+
+	// operations which fail aren't left in the log, so they don't stop it
+	// from being replayed
+	if err := d.Apply(&Operation{Action: ActionAppend, Selector: "nums", Payload: "x"}); err == nil {
+		t.Error("expected an error appending a string to nums")
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if restored.seq != 5 {
+		t.Errorf("got seq %d, want 5", restored.seq)
+	}
+
+	expectJSON(t, restored, map[string]string{
+		"nums":  "[1, 9007199254740993]",
+		"names": `{"a": -9223372036854775808}`,
+		"total": "5",
+	})
+}
+
+func TestRestoreTornLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d, &Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("1")})
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, LogFile)
+
+	complete, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last operation was only partly written
+	torn := append(complete, `{"seq": 2, "action": "append", "sel`...)
+	if err := ioutil.WriteFile(path, torn, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectJSON(t, restored, map[string]string{"nums": "[1]"})
+
+	if got, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, complete) {
+		t.Errorf("got log %q, want %q", got, complete)
+	}
+
+	// new operations start on a line of their own
+	mustApply(t, restored, &Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("2")})
+
+	if err := restored.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+
+	expectJSON(t, again, map[string]string{"nums": "[1, 2]"})
+}
+
+func TestRestoreCorruptLog(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	log := `{"seq": 1, "action": "append", "selector": "nums", "payload": 1}
+not an operation
+{"seq": 3, "action": "append", "selector": "nums", "payload": 3}
+`
+
+	path := filepath.Join(dir, LogFile)
+	if err := ioutil.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := OpenString(storageTestSchema, dir)
+	if err == nil {
+		t.Fatal("expected an error restoring a log with a corrupt line")
+	}
+
+	if e, ok := err.(*Error); !ok || !strings.Contains(e.Message, "offset 65") {
+		t.Errorf("expected an error at offset 65, but got %v", err)
+	}
+
+	// committed operations after the corrupt line are kept
+	if got, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(got) != log {
+		t.Errorf("the log was changed to %q", got)
+	}
+}
+
+func TestUnloggableOperations(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, err := OpenString(storageTestSchema, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustApply(t, d, &Operation{Action: ActionAppend, Selector: "nums", Payload: json.Number("1")})
+
+	// nothing can be written to the log once its file is closed
+	if err := d.log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := []*Operation{
+		{Action: ActionAppend, Selector: "nums", Payload: json.Number("2")},
+		{Action: ActionIncr, Selector: "total"},
+		{Action: ActionUpdate, Selector: "nums", Payload: map[string]interface{}{}},
+		{Action: ActionTransaction, Operations: []*Operation{
+			{Action: ActionEmpty, Selector: "nums"},
+		}},
+	}
+
+	for _, op := range ops {
+		if err := d.Apply(op); err == nil {
+			t.Errorf("%s %s: expected an error", op.Action, op.Selector)
+		}
+	}
+
+	if d.seq != 1 {
+		t.Errorf("got seq %d, want 1", d.seq)
+	}
+
+	expectJSON(t, d, map[string]string{
+		"nums":  "[1]",
+		"total": "0",
+	})
+}
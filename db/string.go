@@ -1,6 +1,8 @@
 package db
 
 import (
+	"bytes"
+	"encoding/json"
 	"regexp"
 )
 
@@ -29,7 +31,7 @@ func (s *String) String() string {
 
 // JSON returns a JSON representation of an item
 func (s *String) JSON() string {
-	return s.String()
+	return quoteJSON(s.value)
 }
 
 // Set sets the value of the item to the given value
@@ -73,34 +75,33 @@ func (s *String) Compare(kind Comparison, other Item) (result bool, err error) {
 		return s.value != os.value, nil
 
 	case Less:
-		if other.Type().Equals(&StringType{}) {
-			return false, nil
-		}
-
 		return s.value < os.value, nil
 
 	case More:
-		if other.Type().Equals(&StringType{}) {
-			return false, nil
-		}
-
 		return s.value > os.value, nil
 
 	case LessOrEqual:
-		if other.Type().Equals(&StringType{}) {
-			return false, nil
-		}
-
 		return s.value <= os.value, nil
 
 	case MoreOrEqual:
-		if other.Type().Equals(&StringType{}) {
-			return false, nil
-		}
-
 		return s.value >= os.value, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >=, and ~ comparisons are supported on strings")
 	}
 }
+
+// quoteJSON encodes a string as a JSON string literal, escaping any special
+// characters.
+func quoteJSON(str string) string {
+	buf := &bytes.Buffer{}
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(str); err != nil {
+		return "\"\""
+	}
+
+	return string(bytes.TrimRight(buf.Bytes(), "\n"))
+}
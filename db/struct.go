@@ -1,6 +1,9 @@
 package db
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
 // A Struct stores pairs of corresponding names and values. Each field has
 // a type, and its value can only be that type.
@@ -50,20 +53,26 @@ func (s *Struct) String() string {
 	return str.String()
 }
 
-// JSON returns a JSON representation of an item
+// JSON returns a JSON representation of an item. The fields are ordered by
+// name, so the same struct always has the same representation.
 func (s *Struct) JSON() string {
+	names := make([]string, 0, len(s.value))
+	for name := range s.value {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
 	str := &strings.Builder{}
 	str.WriteByte('{')
 
-	i := 0
-	for name, val := range s.value {
+	for i, name := range names {
 		if i > 0 {
 			str.WriteString(", ")
 		}
 		str.WriteString("\"" + name + "\"")
 		str.WriteString(": ")
-		str.WriteString(val.JSON())
-		i++
+		str.WriteString(s.value[name].JSON())
 	}
 
 	str.WriteByte('}')
@@ -116,7 +125,7 @@ func (s *Struct) GetField(key string) (result Item, err error) {
 func (s *Struct) SetField(key string, to Item) (err error) {
 	reqType, ok := s.ty.Fields[key]
 	if !ok {
-		return newError(ErrIndex, "cannot retrieve undefined field %s")
+		return newError(ErrIndex, "cannot retrieve undefined field %s", key)
 	}
 	if !to.Type().Equals(reqType) {
 		return newError(
@@ -132,3 +141,23 @@ func (s *Struct) SetField(key string, to Item) (err error) {
 
 	return nil
 }
+
+// Project returns a new struct containing only the given fields of s. The
+// values of the fields aren't copied.
+func (s *Struct) Project(fields []string) (result Item, err error) {
+	ty, err := projectType(s.ty, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	str := &Struct{
+		ty:    ty.(*StructType),
+		value: make(map[string]Item, len(fields)),
+	}
+
+	for _, name := range fields {
+		str.value[name] = s.value[name]
+	}
+
+	return str, nil
+}
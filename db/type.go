@@ -13,6 +13,10 @@ type (
 	StructType struct {
 		Name   string
 		Fields map[string]Type
+
+		// Refs maps the names of fields which hold IDs to the top-level
+		// field which the IDs refer to.
+		Refs map[string]string
 	}
 
 	// ListType stores an ordered homogenous sequence of elements
@@ -67,6 +71,12 @@ func (s *StructType) Equals(other Type) bool {
 		return true
 
 	case *StructType:
+		// a struct's fields can refer to the struct itself, e.g. a user's
+		// friends, so comparing them would never end
+		if s == o {
+			return true
+		}
+
 		if s.Name != o.Name || len(s.Fields) != len(o.Fields) {
 			return false
 		}
@@ -242,3 +252,91 @@ func (f *AnyType) String() string { return "any" }
 func (f *AnyType) Equals(other Type) bool {
 	return true
 }
+
+// projectType returns the type of the result of projecting an item of type ty
+// to the given fields.
+func projectType(ty Type, fields []string) (result Type, err error) {
+	switch t := ty.(type) {
+	case *StructType:
+		str := &StructType{
+			Name:   t.Name,
+			Fields: make(map[string]Type, len(fields)),
+		}
+
+		for _, name := range fields {
+			fieldType, ok := t.Fields[name]
+			if !ok {
+				return nil, newError(ErrIndex, "cannot project undefined field %s of %s", name, t)
+			}
+
+			str.Fields[name] = fieldType
+		}
+
+		return str, nil
+
+	case *ListType:
+		elemType, err := projectType(t.ElemType, fields)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ListType{ElemType: elemType}, nil
+
+	case *HashmapType:
+		valType, err := projectType(t.ValType, fields)
+		if err != nil {
+			return nil, err
+		}
+
+		return &HashmapType{KeyType: t.KeyType, ValType: valType}, nil
+
+	case *AnyType:
+		return t, nil
+	}
+
+	return nil, newError(ErrNOOP, "cannot project a %s", ty)
+}
+
+// fieldType returns the type of the result of getting the given field of an
+// item of type ty.
+func fieldType(ty Type, key string) (result Type, err error) {
+	switch t := ty.(type) {
+	case *StructType:
+		fieldType, ok := t.Fields[key]
+		if !ok {
+			return nil, newError(ErrIndex, "cannot retrieve undefined field %s", key)
+		}
+
+		return fieldType, nil
+
+	case *ListType:
+		return mappedFieldType(t.ElemType, key)
+
+	case *HashmapType:
+		if _, ok := t.KeyType.(*StringType); ok {
+			return t.ValType, nil
+		}
+
+		return mappedFieldType(t.ValType, key)
+
+	case *AnyType:
+		return t, nil
+	}
+
+	return nil, newError(ErrNOOP, "getfield not supported")
+}
+
+// mappedFieldType returns the type of the result of getting the given field of
+// every item in a collection, whose elements are of type elemType.
+func mappedFieldType(elemType Type, key string) (result Type, err error) {
+	ty, err := fieldType(elemType, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if list, ok := ty.(*ListType); ok {
+		return list, nil
+	}
+
+	return &ListType{ElemType: ty}, nil
+}
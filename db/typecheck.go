@@ -0,0 +1,203 @@
+package db
+
+import "strings"
+
+// checkFilter checks the arguments of the functions called in a filter against
+// the schema, given the type of the elements being filtered, so that a mistake
+// like "lower(age)" is an error even if there aren't any elements. Only the
+// types which can be worked out without evaluating the filter are checked, and
+// anything else is checked as each element is filtered.
+func checkFilter(filter *SelectorFilter, elemType Type, params Params) (err error) {
+	if filter.Slice || filter.Condition == nil {
+		return nil
+	}
+
+	_, err = conditionType(filter.Condition, elemType, params)
+	return err
+}
+
+// elementType returns the type of the elements of a list, or the values of a
+// hashmap. For any other type, it returns nil.
+func elementType(ty Type) Type {
+	switch t := ty.(type) {
+	case *ListType:
+		return t.ElemType
+
+	case *HashmapType:
+		return t.ValType
+	}
+
+	return nil
+}
+
+// conditionType checks the function calls in a condition, and returns the type
+// of its result, or nil if that can't be worked out.
+func conditionType(cond *SelectorCondition, elemType Type, params Params) (ty Type, err error) {
+	for _, conj := range cond.Or {
+		for _, term := range conj.And {
+			if ty, err = termType(term, elemType, params); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(cond.Or) == 1 && len(cond.Or[0].And) == 1 {
+		return ty, nil
+	}
+
+	return &BoolType{}, nil
+}
+
+func termType(term *SelectorTerm, elemType Type, params Params) (ty Type, err error) {
+	if term.Not != nil {
+		if _, err := termType(term.Not, elemType, params); err != nil {
+			return nil, err
+		}
+
+		return &BoolType{}, nil
+	}
+
+	cmp := term.Comparison
+
+	// with no left hand side, the element itself is compared
+	ty = elemType
+	if cmp.Left != nil {
+		if ty, err = sumType(cmp.Left, elemType, params); err != nil {
+			return nil, err
+		}
+	}
+
+	if cmp.Right == nil {
+		return ty, nil
+	}
+
+	if _, err := sumType(cmp.Right, elemType, params); err != nil {
+		return nil, err
+	}
+
+	return &BoolType{}, nil
+}
+
+func sumType(sum *SelectorSum, elemType Type, params Params) (ty Type, err error) {
+	if ty, err = productType(sum.Left, elemType, params); err != nil {
+		return nil, err
+	}
+
+	for _, operand := range sum.Right {
+		if _, err := productType(operand.Product, elemType, params); err != nil {
+			return nil, err
+		}
+	}
+
+	// the result of arithmetic depends on the values
+	if len(sum.Right) > 0 {
+		return nil, nil
+	}
+
+	return ty, nil
+}
+
+func productType(product *SelectorProduct, elemType Type, params Params) (ty Type, err error) {
+	if ty, err = unaryType(product.Left, elemType, params); err != nil {
+		return nil, err
+	}
+
+	for _, operand := range product.Right {
+		if _, err := unaryType(operand.Unary, elemType, params); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(product.Right) > 0 {
+		return nil, nil
+	}
+
+	return ty, nil
+}
+
+func unaryType(unary *SelectorUnary, elemType Type, params Params) (ty Type, err error) {
+	if ty, err = valueType(unary.Value, elemType, params); err != nil {
+		return nil, err
+	}
+
+	if unary.Negate {
+		return nil, nil
+	} else if unary.Not {
+		return &BoolType{}, nil
+	}
+
+	return ty, nil
+}
+
+func valueType(val *SelectorValue, elemType Type, params Params) (ty Type, err error) {
+	if lit := val.Literal; lit != nil {
+		return selectorLiteralToItem(lit).Type(), nil
+	} else if fn := val.Function; fn != nil {
+		return functionType(fn, elemType, params)
+	} else if field := val.Field; field != nil {
+		if elemType == nil {
+			return nil, nil
+		}
+
+		// a field which doesn't exist is only an error if it's evaluated,
+		// since e.g. has() checks for missing fields
+		ty, err := fieldType(elemType, *field)
+		if err != nil {
+			return nil, nil
+		}
+
+		return ty, nil
+	} else if name := val.Variable; name != nil {
+		// an undefined variable is reported by valueToEvaluator
+		v, err := params.lookup(strings.TrimPrefix(*name, "$"))
+		if err != nil {
+			return nil, nil
+		}
+
+		return v.Type(), nil
+	} else if group := val.Group; group != nil {
+		return conditionType(group, elemType, params)
+	}
+
+	return nil, nil
+}
+
+// functionType checks the types of the arguments of a function call, and
+// returns the type of its result. Undefined functions and the wrong number of
+// arguments are reported by functionToEvaluator instead.
+func functionType(call *SelectorFunction, elemType Type, params Params) (ty Type, err error) {
+	def, ok := functions[call.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	args := call.Args
+	if len(args) == 1 && args[0].isEmpty() {
+		args = nil
+	}
+
+	if len(args) != len(def.args) {
+		return def.result, nil
+	}
+
+	for i, arg := range args {
+		argType, err := conditionType(arg, elemType, params)
+		if err != nil {
+			return nil, err
+		}
+
+		if argType == nil {
+			continue
+		}
+
+		if _, ok := argType.(*AnyType); ok {
+			continue
+		}
+
+		if !def.args[i].accepts(argType) {
+			return nil, newError(ErrType, "argument %d of %s must be %s, but got a %s", i+1, call.Name, def.args[i].name, argType)
+		}
+	}
+
+	return def.result, nil
+}
@@ -32,43 +32,41 @@ func (i *Uint) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Uint) Set(val interface{}) (err error) {
-	fval, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = uint64(fval)
+	i.value = uint64(ival.Uint64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Uint) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare uints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on uints")
@@ -107,43 +105,41 @@ func (i *Uint32) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Uint32) Set(val interface{}) (err error) {
-	fval, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = uint32(fval)
+	i.value = uint32(ival.Uint64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Uint32) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare uints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on uints")
@@ -182,43 +178,41 @@ func (i *Uint16) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Uint16) Set(val interface{}) (err error) {
-	fval, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = uint16(fval)
+	i.value = uint16(ival.Uint64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Uint16) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare uints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on uints")
@@ -257,43 +251,41 @@ func (i *Uint8) JSON() string {
 
 // Set sets the value of the item to the given value
 func (i *Uint8) Set(val interface{}) (err error) {
-	fval, ok := val.(float64)
-	if !ok {
-		return newError(ErrType, "expected an integer value")
+	ival, err := parseInteger(val, i.Type())
+	if err != nil {
+		return err
 	}
 
-	i.value = uint8(fval)
+	i.value = uint8(ival.Uint64())
 
 	return nil
 }
 
 // Compare compares two items
 func (i *Uint8) Compare(kind Comparison, other Item) (result bool, err error) {
-	oval, ok := castNumeric(other)
+	cmp, ok := compareNumbers(i, other)
 	if !ok {
 		return false, newError(ErrNOOP, "can only compare uints with numeric types (ints, floats, uints, ...)")
 	}
 
-	sval, _ := castNumeric(i)
-
 	switch kind {
 	case Equal:
-		return sval == oval, nil
+		return cmp == 0, nil
 
 	case NotEqual:
-		return sval != oval, nil
+		return cmp != 0, nil
 
 	case Less:
-		return sval < oval, nil
+		return cmp < 0, nil
 
 	case More:
-		return sval > oval, nil
+		return cmp > 0, nil
 
 	case LessOrEqual:
-		return sval <= oval, nil
+		return cmp <= 0, nil
 
 	case MoreOrEqual:
-		return sval >= oval, nil
+		return cmp >= 0, nil
 
 	default:
 		return false, newError(ErrNOOP, "only =, !=, <, >, <=, >= comparisons are supported on uints")
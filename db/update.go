@@ -0,0 +1,143 @@
+package db
+
+import "sort"
+
+// An update is a list of assignments, which an update operation applies to
+// each of the elements it selects.
+type update []*assignment
+
+// An assignment sets a field of an element to a value. The value is computed
+// from the element, and returned as it would be decoded from JSON, so that it
+// can be passed to Item.Set.
+type assignment struct {
+	field string
+	value func(elem Item) (val interface{}, err error)
+}
+
+// makeUpdate makes an update from the payload of an update operation, which is
+// either an object mapping fields to their new values, e.g.
+// {"completed": true}, or a string of assignments, e.g. "likes += 1".
+func makeUpdate(payload interface{}, params Params) (upd update, err error) {
+	switch p := payload.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(p))
+		for name := range p {
+			names = append(names, name)
+		}
+
+		// sorted, so that any error is always the same
+		sort.Strings(names)
+
+		for _, name := range names {
+			val := p[name]
+
+			upd = append(upd, &assignment{
+				field: name,
+				value: func(elem Item) (interface{}, error) {
+					return val, nil
+				},
+			})
+		}
+
+		return upd, nil
+
+	case string:
+		sel := &SelectorUpdate{}
+		if err := UpdateParser.ParseString(p, sel); err != nil {
+			return nil, err
+		}
+
+		for _, a := range sel.Assignments {
+			if upd, err = appendAssignment(upd, a, params); err != nil {
+				return nil, err
+			}
+		}
+
+		return upd, nil
+	}
+
+	return nil, newError(ErrType, "expected an object of fields to set, or a string of assignments")
+}
+
+func appendAssignment(upd update, a *SelectorAssignment, params Params) (result update, err error) {
+	eval, _, err := sumToEvaluator(a.Value, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Operator != "" {
+		field := a.Field
+		current := func(item Item) (result Item, err error) {
+			return item.GetField(field)
+		}
+
+		eval = arithmeticEvaluator(a.Operator, current, eval)
+	}
+
+	return append(upd, &assignment{
+		field: a.Field,
+		value: func(elem Item) (val interface{}, err error) {
+			res, err := eval(elem)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := DecodeJSON([]byte(res.JSON()), &val); err != nil {
+				return nil, newError(ErrType, "could not convert %s to a value", res)
+			}
+
+			return val, nil
+		},
+	}), nil
+}
+
+// applyEach applies the update to each element of a list or hashmap, or to the
+// item itself if it's anything else. The elements are the same items as are
+// stored in the database, even if the list or hashmap is the result of a
+// filter, so they're modified in place.
+func (u update) applyEach(item Item) (err error) {
+	targets := []Item{item}
+
+	switch item.(type) {
+	case *List, *Hashmap:
+		if targets, _, err = elements(item); err != nil {
+			return err
+		}
+	}
+
+	for _, elem := range targets {
+		if err := u.apply(elem); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply applies the update to a single element. Every value is computed before
+// any of them are set, so "a = b, b = a" swaps a and b.
+func (u update) apply(elem Item) (err error) {
+	vals := make([]interface{}, len(u))
+
+	for i, a := range u {
+		if vals[i], err = a.value(elem); err != nil {
+			return err
+		}
+	}
+
+	for i, a := range u {
+		field, err := elem.GetField(a.field)
+		if err == nil {
+			err = field.Set(vals[i])
+		} else if _, ok := elem.(*Hashmap); ok && isMissing(err) {
+			// new keys can be added to hashmaps
+			err = elem.SetKeyJSON(a.field, vals[i])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
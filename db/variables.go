@@ -0,0 +1,188 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+// Params maps variable names (without the leading '$') to their values. They
+// are passed to a query alongside a selector, so that values don't need to be
+// inserted into the selector string itself.
+type Params map[string]Item
+
+// builtinVariables are the variables which are available in every selector.
+// Each one is computed every time it's used in a query, but only once per
+// operation, since Apply stores their values in the operation's params.
+var builtinVariables = map[string]func() Item{
+	// NOW is the current unix time in seconds, including the fractional part.
+	"NOW": func() Item {
+		return NewFloat(float64(time.Now().UnixNano()) / float64(time.Second))
+	},
+
+	// TIMESTAMP is the current unix time in whole seconds.
+	"TIMESTAMP": func() Item {
+		return NewInt(time.Now().Unix())
+	},
+}
+
+// lookup finds the value of a variable, first looking in the given params and
+// then in the built-in variables.
+func (p Params) lookup(name string) (val Item, err error) {
+	if val, ok := p[name]; ok {
+		return val, nil
+	}
+
+	if builtin, ok := builtinVariables[name]; ok {
+		return builtin(), nil
+	}
+
+	return nil, newError(ErrIndex, "undefined variable $%s", name)
+}
+
+// resolveBuiltins adds the value of each built-in variable which the operation
+// uses, and which isn't already one of its params, to its params. This means
+// that replaying the operation from the log gives the same result as applying
+// it did.
+func (op *Operation) resolveBuiltins() {
+	for _, sub := range op.Operations {
+		sub.resolveBuiltins()
+	}
+
+	sources := []string{op.Selector}
+	if upd, ok := op.Payload.(string); ok && op.Action == ActionUpdate {
+		sources = append(sources, upd)
+	}
+
+	for _, src := range sources {
+		for _, name := range variablesIn(src) {
+			builtin, ok := builtinVariables[name]
+			if !ok {
+				continue
+			}
+
+			if _, ok := op.Params[name]; ok {
+				continue
+			}
+
+			if op.Params == nil {
+				op.Params = make(map[string]interface{})
+			}
+
+			op.Params[name] = json.Number(builtin().JSON())
+		}
+	}
+}
+
+// variablesIn returns the names of the variables used in a selector. If the
+// selector can't be lexed, it won't parse either, so no names are returned.
+func variablesIn(selector string) (names []string) {
+	tokens, err := lexer.ConsumeAll(selectorLexer.Lex(strings.NewReader(selector)))
+	if err != nil {
+		return nil
+	}
+
+	for _, token := range tokens {
+		if token.Type == selectorSymbols["Variable"] {
+			names = append(names, strings.TrimPrefix(token.Value, "$"))
+		}
+	}
+
+	return names
+}
+
+// ParamsFromJSON makes a set of params from a decoded JSON object. Since
+// there is no schema to say what type each value should be, numbers become
+// floats, or ints or uints if they were decoded as whole json.Numbers, lists
+// and objects become [any] and <string:any>, and null becomes Null.
+func ParamsFromJSON(json map[string]interface{}) (params Params, err error) {
+	params = make(Params, len(json))
+
+	for name, val := range json {
+		params[name], err = jsonToItem(val)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+// numberToItem converts a number to an Int, or a Uint if it's too large, so
+// that whole numbers stay exact. Anything else becomes a Float, and if it isn't
+// a valid number at all, the result is nil.
+func numberToItem(num json.Number) Item {
+	if i, err := num.Int64(); err == nil {
+		return NewInt(i)
+	}
+
+	if u, err := strconv.ParseUint(num.String(), 10, 64); err == nil {
+		return NewUint(u)
+	}
+
+	f, err := num.Float64()
+	if err != nil {
+		return nil
+	}
+
+	return NewFloat(f)
+}
+
+func jsonToItem(data interface{}) (item Item, err error) {
+	switch val := data.(type) {
+	case float64:
+		return NewFloat(val), nil
+
+	case json.Number:
+		if item := numberToItem(val); item != nil {
+			return item, nil
+		}
+
+		return nil, newError(ErrType, "invalid number: %s", val)
+
+	case string:
+		return NewString(val), nil
+
+	case bool:
+		return NewBool(val), nil
+
+	case nil:
+		return NewNull(), nil
+
+	case []interface{}:
+		list := NewList(&AnyType{})
+
+		for _, elem := range val {
+			item, err := jsonToItem(elem)
+			if err != nil {
+				return nil, err
+			}
+
+			list.Append(item)
+		}
+
+		return list, nil
+
+	case map[string]interface{}:
+		hashmap := NewHashmap(&StringType{}, &AnyType{})
+
+		for k, v := range val {
+			item, err := jsonToItem(v)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := hashmap.SetKey(NewString(k), item); err != nil {
+				return nil, err
+			}
+		}
+
+		return hashmap, nil
+
+	default:
+		return nil, newError(ErrType, "unsupported JSON value: %v", data)
+	}
+}
@@ -2,15 +2,14 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
+
+	"github.com/Zac-Garby/siphon/client"
 )
 
 type todo struct {
@@ -20,9 +19,13 @@ type todo struct {
 
 func main() {
 	fmt.Println("Welcome to the example TODO app")
-	fmt.Println("Enter either 'ls', 'add', 'done', 'rm', 'clear', or 'quit'")
+	fmt.Println("Enter either 'ls', 'add', 'done', 'rm', 'clean', 'clear', or 'quit'")
 
-	r := bufio.NewReader(os.Stdin)
+	var (
+		r   = bufio.NewReader(os.Stdin)
+		c   = client.NewClient("http://localhost:7913")
+		ctx = context.Background()
+	)
 
 outer:
 	for {
@@ -30,15 +33,9 @@ outer:
 
 		switch line {
 		case "ls":
-			resp, err := request("GET", "json?selector=todos", "")
-			if err != nil {
-				fmt.Println(err)
-				continue outer
-			}
-
-			todos := make([]*todo, 4)
+			var todos []*todo
 
-			if err := json.Unmarshal(resp, &todos); err != nil {
+			if err := c.Get(ctx, "todos", nil, &todos); err != nil {
 				fmt.Println(err)
 				continue outer
 			}
@@ -60,13 +57,7 @@ outer:
 				Description: description,
 			}
 
-			encoded, err := json.Marshal(todo)
-			if err != nil {
-				fmt.Println(err)
-				continue outer
-			}
-
-			if _, err = request("POST", "append?selector=todos", string(encoded)); err != nil {
+			if err := c.Append(ctx, "todos", nil, todo); err != nil {
 				fmt.Println(err)
 				continue outer
 			}
@@ -74,25 +65,15 @@ outer:
 		case "done":
 			index := input("todo index> ", r)
 
-			if _, err := strconv.ParseInt(index, 10, 64); err != nil {
-				fmt.Println("invalid index -- not an integer")
-				continue outer
-			}
-
-			resp, err := request("GET", fmt.Sprintf("json?selector=todos[%s].completed", index), "")
+			i, err := strconv.ParseInt(index, 10, 64)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Println("invalid index -- not an integer")
 				continue outer
 			}
 
-			wasCompleted := false
+			params := client.Params{"i": i}
 
-			if err := json.Unmarshal(resp, &wasCompleted); err != nil {
-				fmt.Println(err)
-				continue outer
-			}
-
-			if _, err = request("POST", fmt.Sprintf("set?selector=todos[%s].completed", index), fmt.Sprint(!wasCompleted)); err != nil {
+			if err := c.Update(ctx, "todos[$i]", params, "completed = !completed"); err != nil {
 				fmt.Println(err)
 				continue outer
 			}
@@ -100,18 +81,28 @@ outer:
 		case "rm":
 			index := input("todo index> ", r)
 
-			if _, err := strconv.ParseInt(index, 10, 64); err != nil {
+			i, err := strconv.ParseInt(index, 10, 64)
+			if err != nil {
 				fmt.Println("invalid index -- not an integer")
 				continue outer
 			}
 
-			if _, err := request("POST", "unset?selector=todos", index); err != nil {
+			if err := c.Unset(ctx, "todos", nil, i); err != nil {
 				fmt.Println(err)
 				continue outer
 			}
 
+		case "clean":
+			removed, err := c.Delete(ctx, "todos[completed]", nil)
+			if err != nil {
+				fmt.Println(err)
+				continue outer
+			}
+
+			fmt.Printf("removed %d completed todos\n", removed)
+
 		case "clear":
-			if _, err := request("POST", "empty?selector=todos", ""); err != nil {
+			if err := c.Empty(ctx, "todos", nil); err != nil {
 				fmt.Println(err)
 				continue outer
 			}
@@ -120,49 +111,9 @@ outer:
 			break outer
 
 		default:
-			fmt.Println("Valid commands are 'ls', 'add', 'done', 'rm', 'clear', or 'quit'")
-		}
-	}
-}
-
-func request(method, path, body string) ([]byte, error) {
-	var resp *http.Response
-	if method == "POST" {
-		response, err := http.Post("http://localhost:7913/"+path, "text/json", strings.NewReader(body))
-		if err != nil {
-			return nil, err
-		}
-
-		resp = response
-	} else if method == "GET" {
-		response, err := http.Get("http://localhost:7913/" + path)
-		if err != nil {
-			return nil, err
+			fmt.Println("Valid commands are 'ls', 'add', 'done', 'rm', 'clean', 'clear', or 'quit'")
 		}
-
-		resp = response
-	} else {
-		return nil, errors.New("only POST and GET requests are supported")
-	}
-
-	r, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		errorStruct := new(struct {
-			Error string `json:"err"`
-		})
-
-		if err := json.Unmarshal(r, &errorStruct); err != nil {
-			return nil, errors.New("unknown error, response not JSON parseable." + resp.Status)
-		}
-
-		return nil, errors.New(errorStruct.Error)
-	}
-
-	return r, nil
 }
 
 func input(prompt string, r *bufio.Reader) string {
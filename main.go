@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
 
 	"github.com/Zac-Garby/siphon/server"
 )
 
 var schemaFile = flag.String("schema", "schema.sip", "the location of the file containing the database schema")
 var port = flag.Int("port", 7913, "the port on which to listen")
+var dataDir = flag.String("data", "", "the directory to store snapshots in. if empty, data is only kept in memory")
+var interval = flag.Duration("interval", 0, "how often to save a snapshot to the data directory. if zero, snapshots are only saved on request and at exit")
+var checkRefs = flag.Bool("refs", false, "check that annotated IDs refer to something which exists whenever data is modified")
 
 func main() {
 	flag.Parse()
@@ -29,8 +34,33 @@ func main() {
 		log.Fatal(err)
 	}
 
+	s.DataDir = *dataDir
+	s.SnapshotInterval = *interval
+	s.Database.CheckReferences = *checkRefs
+
+	if err := s.Restore(); err != nil {
+		log.Fatal(err)
+	}
+
+	if *dataDir != "" {
+		go snapshotOnInterrupt(s)
+	}
+
 	fmt.Printf("listening on :%d...\n", *port)
 	if err := s.Listen(); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func snapshotOnInterrupt(s *server.Server) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	<-c
+
+	fmt.Println("saving snapshot...")
+	if err := s.Snapshot(); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(0)
+}
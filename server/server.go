@@ -2,10 +2,15 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/Zac-Garby/siphon/db"
 	"github.com/gorilla/mux"
@@ -15,16 +20,21 @@ import (
 type Server struct {
 	Addr     string
 	Database *db.DB
+
+	// DataDir is the directory which snapshots of the database and the log
+	// are saved in. If it's empty, the database is only stored in memory.
+	DataDir string
+
+	// SnapshotInterval is how often a snapshot is saved to DataDir. If it's
+	// zero, snapshots are only saved when requested through /snapshot.
+	SnapshotInterval time.Duration
+
+	subscriptions registry
 }
 
 // NewServer makes a new server, initialising a database from the schema string.
 func NewServer(addr, schema string) (*Server, error) {
-	sch := &db.Schema{}
-	if err := db.SchemaParser.ParseString(schema, sch); err != nil {
-		return nil, err
-	}
-
-	d, err := db.MakeDB(sch)
+	d, err := db.OpenString(schema, "")
 	if err != nil {
 		return nil, err
 	}
@@ -37,56 +47,71 @@ func NewServer(addr, schema string) (*Server, error) {
 
 // Listen starts listening on the given address.
 func (s *Server) Listen() error {
+	if s.DataDir != "" && s.SnapshotInterval > 0 {
+		go s.snapshotPeriodically()
+	}
+
+	return http.ListenAndServe(s.Addr, s.router())
+}
+
+// router makes the handler which serves every route.
+func (s *Server) router() http.Handler {
 	r := mux.NewRouter()
 	r.HandleFunc("/json", s.handleJSON)
-	r.HandleFunc("/set", s.handleSet)
-	r.HandleFunc("/unset", s.handleUnset)
-	r.HandleFunc("/append", s.handleAppend)
-	r.HandleFunc("/prepend", s.handlePrepend)
-	r.HandleFunc("/key", s.handleKey)
-	r.HandleFunc("/empty", s.handleEmpty)
-
-	return http.ListenAndServe(s.Addr, r)
+	r.HandleFunc("/set", s.handleOperation(db.ActionSet))
+	r.HandleFunc("/unset", s.handleOperation(db.ActionUnset))
+	r.HandleFunc("/append", s.handleOperation(db.ActionAppend))
+	r.HandleFunc("/prepend", s.handleOperation(db.ActionPrepend))
+	r.HandleFunc("/key", s.handleOperation(db.ActionKey))
+	r.HandleFunc("/empty", s.handleOperation(db.ActionEmpty))
+	r.HandleFunc("/update", s.handleOperation(db.ActionUpdate))
+	r.HandleFunc("/delete", s.handleOperation(db.ActionDelete))
+	r.HandleFunc("/incr", s.handleOperation(db.ActionIncr))
+	r.HandleFunc("/decr", s.handleOperation(db.ActionDecr))
+	r.HandleFunc("/min", s.handleOperation(db.ActionMin))
+	r.HandleFunc("/max", s.handleOperation(db.ActionMax))
+	r.HandleFunc("/tx", s.handleTransaction)
+	r.HandleFunc("/session", s.handleSession)
+	r.HandleFunc("/subscribe", s.handleSubscribe)
+	r.HandleFunc("/snapshot", s.handleSnapshot)
+
+	return r
 }
 
-func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/json")
-
-	if r.Method != "GET" {
-		errorMessage(w, "only GET is supported for /json")
-		return
+// Restore loads the latest snapshot from the data directory, if there is one,
+// and replays the log on top of it. From then on, every modification is
+// written to the log.
+func (s *Server) Restore() error {
+	if s.DataDir == "" {
+		return nil
 	}
 
-	if err := r.ParseForm(); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+	return s.Database.Restore(s.DataDir)
+}
 
-	if len(r.Form["selector"]) != 1 {
-		errorMessage(w, "only one form value expected for the selector")
-		return
+// Snapshot saves a snapshot of the database to the data directory, and
+// compacts the log.
+func (s *Server) Snapshot() error {
+	if s.DataDir == "" {
+		return errors.New("no data directory was specified")
 	}
 
-	selector, err := url.QueryUnescape(r.Form["selector"][0])
-	if err != nil {
-		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
-		return
-	}
+	return s.Database.Compact()
+}
 
-	res, err := s.Database.QueryString(selector)
-	if err != nil {
-		errorMessage(w, err.Error())
-		return
+func (s *Server) snapshotPeriodically() {
+	for range time.Tick(s.SnapshotInterval) {
+		if err := s.Snapshot(); err != nil {
+			log.Println("snapshot:", err)
+		}
 	}
-
-	fmt.Fprint(w, res.JSON())
 }
 
-func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleJSON(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/json")
 
-	if r.Method != "POST" {
-		errorMessage(w, "only POST is supported for /set")
+	if r.Method != "GET" {
+		errorMessage(w, "only GET is supported for /json")
 		return
 	}
 
@@ -106,162 +131,151 @@ func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Body == nil {
-		errorMessage(w, "expected a request body")
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
+	params, err := parseParams(r)
 	if err != nil {
-		errorMessage(w, "could not read request body")
+		errorMessage(w, err.Error())
 		return
 	}
 
-	item, err := s.Database.QueryString(selector)
+	start, end, err := parsePage(r)
 	if err != nil {
 		errorMessage(w, err.Error())
 		return
 	}
 
-	var val interface{}
-	if err := json.Unmarshal(body, &val); err != nil {
+	out, err := s.queryPage(selector, params, start, end)
+	if err != nil {
 		errorMessage(w, err.Error())
 		return
 	}
 
-	if err = item.Set(val); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+	fmt.Fprint(w, out)
 }
 
-func (s *Server) handleAppend(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/json")
-
-	if r.Method != "POST" {
-		errorMessage(w, "only POST is supported for /append")
-		return
-	}
-
-	if err := r.ParseForm(); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
-
-	if len(r.Form["selector"]) != 1 {
-		errorMessage(w, "only one form value expected for the selector")
-		return
-	}
+// query queries the database with a selector, returning the result as JSON.
+func (s *Server) query(selector string, jsonParams map[string]interface{}) (string, error) {
+	return s.queryPage(selector, jsonParams, nil, nil)
+}
 
-	selector, err := url.QueryUnescape(r.Form["selector"][0])
+// queryPage is like query, but if start or end isn't nil, the result is
+// sliced, as if "[start:end]" was added to the selector.
+func (s *Server) queryPage(selector string, jsonParams map[string]interface{}, start, end db.Item) (string, error) {
+	params, err := db.ParamsFromJSON(jsonParams)
 	if err != nil {
-		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
-		return
+		return "", err
 	}
 
-	if r.Body == nil {
-		errorMessage(w, "expected a request body")
-		return
-	}
+	var out string
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		errorMessage(w, "could not read request body")
-		return
-	}
+	err = s.Database.Read(selector, params, func(res db.Item) error {
+		if start != nil || end != nil {
+			page, err := res.Slice(start, end)
+			if err != nil {
+				return err
+			}
 
-	item, err := s.Database.QueryString(selector)
-	if err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+			res = page
+		}
 
-	var val interface{}
-	if err := json.Unmarshal(body, &val); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+		out = res.JSON()
+		return nil
+	})
 
-	if err = item.AppendJSON(val); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+	return out, err
 }
 
-func (s *Server) handlePrepend(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/json")
-
-	if r.Method != "POST" {
-		errorMessage(w, "only POST is supported for /prepend")
-		return
-	}
-
-	if err := r.ParseForm(); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
-
-	if len(r.Form["selector"]) != 1 {
-		errorMessage(w, "only one form value expected for the selector")
-		return
-	}
-
-	selector, err := url.QueryUnescape(r.Form["selector"][0])
-	if err != nil {
-		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
-		return
-	}
-
-	if r.Body == nil {
-		errorMessage(w, "expected a request body")
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		errorMessage(w, "could not read request body")
-		return
+// handleOperation makes a handler for one of the routes which modify data,
+// e.g. /set. The selector and params are taken from the query string, and the
+// payload is the JSON encoded request body.
+func (s *Server) handleOperation(action db.Action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/json")
+
+		if r.Method != "POST" {
+			errorMessage(w, fmt.Sprintf("only POST is supported for /%s", action))
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			errorMessage(w, err.Error())
+			return
+		}
+
+		if len(r.Form["selector"]) != 1 {
+			errorMessage(w, "only one form value expected for the selector")
+			return
+		}
+
+		selector, err := url.QueryUnescape(r.Form["selector"][0])
+		if err != nil {
+			errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
+			return
+		}
+
+		params, err := parseParams(r)
+		if err != nil {
+			errorMessage(w, err.Error())
+			return
+		}
+
+		op := &db.Operation{
+			Action:   action,
+			Selector: selector,
+			Params:   params,
+		}
+
+		// /empty and /delete are the only routes which don't need any data
+		if action != db.ActionEmpty && action != db.ActionDelete {
+			if r.Body == nil {
+				errorMessage(w, "expected a request body")
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				errorMessage(w, "could not read request body")
+				return
+			}
+
+			// /incr and /decr count by 1 if there's no data
+			isCounter := action == db.ActionIncr || action == db.ActionDecr
+
+			if len(body) > 0 || !isCounter {
+				if err := db.DecodeJSON(body, &op.Payload); err != nil {
+					errorMessage(w, err.Error())
+					return
+				}
+			}
+		}
+
+		if err := s.apply(op); err != nil {
+			errorMessage(w, err.Error())
+			return
+		}
+
+		fmt.Fprint(w, operationResult(op))
 	}
+}
 
-	item, err := s.Database.QueryString(selector)
-	if err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+// operationResult returns the JSON which is sent back after an operation has
+// been applied, or "" if there isn't anything to send.
+func operationResult(op *db.Operation) string {
+	switch op.Action {
+	case db.ActionDelete:
+		return fmt.Sprintf(`{"removed": %d}`, op.Removed)
 
-	var val interface{}
-	if err := json.Unmarshal(body, &val); err != nil {
-		errorMessage(w, err.Error())
-		return
+	case db.ActionIncr, db.ActionDecr, db.ActionMin, db.ActionMax:
+		return op.Result
 	}
 
-	if err = item.PrependJSON(val); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+	return ""
 }
 
-func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleTransaction(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/json")
 
 	if r.Method != "POST" {
-		errorMessage(w, "only POST is supported for /key")
-		return
-	}
-
-	if err := r.ParseForm(); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
-
-	if len(r.Form["selector"]) != 1 {
-		errorMessage(w, "only one form value expected for the selector")
-		return
-	}
-
-	selector, err := url.QueryUnescape(r.Form["selector"][0])
-	if err != nil {
-		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
+		errorMessage(w, "only POST is supported for /tx")
 		return
 	}
 
@@ -270,121 +284,100 @@ func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item, err := s.Database.QueryString(selector)
-	if err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
-
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		errorMessage(w, "could not read request body")
 		return
 	}
 
-	data := struct {
-		Key   interface{} `json:"key"`
-		Value interface{} `json:"value"`
-	}{}
-
-	if err := json.Unmarshal(body, &data); err != nil {
+	var ops []*db.Operation
+	if err := db.DecodeJSON(body, &ops); err != nil {
 		errorMessage(w, err.Error())
 		return
 	}
 
-	if err := item.SetKeyJSON(data.Key, data.Value); err != nil {
+	err = s.apply(&db.Operation{
+		Action:     db.ActionTransaction,
+		Operations: ops,
+	})
+
+	if err != nil {
 		errorMessage(w, err.Error())
 		return
 	}
 }
 
-func (s *Server) handleUnset(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/json")
 
 	if r.Method != "POST" {
-		errorMessage(w, "only POST is supported for /unset")
+		errorMessage(w, "only POST is supported for /snapshot")
 		return
 	}
 
-	if err := r.ParseForm(); err != nil {
+	if err := s.Snapshot(); err != nil {
 		errorMessage(w, err.Error())
 		return
 	}
+}
 
-	if len(r.Form["selector"]) != 1 {
-		errorMessage(w, "only one form value expected for the selector")
-		return
-	}
-
-	selector, err := url.QueryUnescape(r.Form["selector"][0])
-	if err != nil {
-		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
-		return
-	}
-
-	if r.Body == nil {
-		errorMessage(w, "expected a request body")
-		return
-	}
-
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		errorMessage(w, "could not read request body")
-		return
+// parseParams reads the optional "params" form value, which should be a JSON
+// object mapping variable names to their values.
+func parseParams(r *http.Request) (map[string]interface{}, error) {
+	if len(r.Form["params"]) == 0 {
+		return nil, nil
 	}
 
-	item, err := s.Database.QueryString(selector)
-	if err != nil {
-		errorMessage(w, err.Error())
-		return
+	if len(r.Form["params"]) != 1 {
+		return nil, errors.New("only one form value expected for the params")
 	}
 
-	var val interface{}
-	if err := json.Unmarshal(body, &val); err != nil {
-		errorMessage(w, err.Error())
-		return
+	var obj map[string]interface{}
+	if err := db.DecodeJSON([]byte(r.Form["params"][0]), &obj); err != nil {
+		return nil, fmt.Errorf("could not decode params: %s", err.Error())
 	}
 
-	if err = item.UnsetKeyJSON(val); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+	return obj, nil
 }
 
-func (s *Server) handleEmpty(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/json")
+// parsePage reads the optional "offset" and "limit" form values, which select
+// a page of a list result. The page is returned as the bounds of a slice, each
+// of which is nil if it's not needed.
+func parsePage(r *http.Request) (start, end db.Item, err error) {
+	var offset, limit int64 = 0, -1
 
-	if r.Method != "POST" {
-		errorMessage(w, "only POST is supported for /empty")
-		return
-	}
+	for name, val := range map[string]*int64{"offset": &offset, "limit": &limit} {
+		if len(r.Form[name]) == 0 {
+			continue
+		}
 
-	if err := r.ParseForm(); err != nil {
-		errorMessage(w, err.Error())
-		return
-	}
+		if len(r.Form[name]) != 1 {
+			return nil, nil, fmt.Errorf("only one form value expected for the %s", name)
+		}
 
-	if len(r.Form["selector"]) != 1 {
-		errorMessage(w, "only one form value expected for the selector")
-		return
-	}
+		n, err := strconv.ParseInt(r.Form[name][0], 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil, fmt.Errorf("the %s should be a non-negative integer", name)
+		}
 
-	selector, err := url.QueryUnescape(r.Form["selector"][0])
-	if err != nil {
-		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
-		return
+		*val = n
 	}
 
-	res, err := s.Database.QueryString(selector)
-	if err != nil {
-		errorMessage(w, err.Error())
-		return
+	if offset > 0 {
+		start = db.NewInt(offset)
 	}
 
-	if err = res.Empty(); err != nil {
-		errorMessage(w, err.Error())
-		return
+	if limit >= 0 {
+		// the slice stops at the end of the list anyway, so if offset +
+		// limit would overflow, the end can be as large as possible
+		if limit > math.MaxInt64-offset {
+			end = db.NewInt(math.MaxInt64)
+		} else {
+			end = db.NewInt(offset + limit)
+		}
 	}
+
+	return start, end, nil
 }
 
 func errorMessage(w http.ResponseWriter, msg string) {
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+const testSchema = `
+todos: [todo]
+counts: <string:int>
+total: int
+
+struct todo {
+    completed: bool
+    description: string
+}`
+
+// TestParallelClients sends requests to a server from many clients at once.
+// Run it with -race.
+func TestParallelClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "siphon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewServer("", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.DataDir = dir
+	if err := s.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	const clients, iterations = 8, 20
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < iterations; j++ {
+				post(t, ts.URL+"/append?selector=todos", `{"completed": false, "description": "todo"}`)
+				post(t, ts.URL+"/key?selector=counts", fmt.Sprintf(`{"key": "c%d-%d", "value": %d}`, i, j, j))
+				post(t, ts.URL+"/incr?selector=total", "")
+				post(t, ts.URL+"/update?selector="+url.QueryEscape("todos[!completed]"), `"completed = true"`)
+
+				get(t, ts.URL+"/json?selector="+url.QueryEscape("todos[completed]"))
+				get(t, ts.URL+"/json?selector=counts")
+
+				if j%5 == 0 {
+					post(t, ts.URL+"/snapshot", "")
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	want := map[string]string{
+		"todos.count()":  fmt.Sprint(clients * iterations),
+		"counts.count()": fmt.Sprint(clients * iterations),
+		"total":          fmt.Sprint(clients * iterations),
+	}
+
+	for sel, n := range want {
+		if got := get(t, ts.URL+"/json?selector="+url.QueryEscape(sel)); got != n {
+			t.Errorf("%s is %s, want %s", sel, got, n)
+		}
+	}
+}
+
+// TestSessionResults checks that operations sent over a session reply with the
+// same results as the corresponding HTTP routes.
+func TestSessionResults(t *testing.T) {
+	s, err := NewServer("", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	conn := dialSession(t, ts)
+	defer conn.Close()
+
+	requests := []struct {
+		req, want string
+	}{
+		{`{"id": 1, "action": "append", "selector": "todos", "payload": {"completed": true, "description": "a"}}`, `{"id":1}`},
+		{`{"id": 2, "action": "append", "selector": "todos", "payload": {"completed": false, "description": "b"}}`, `{"id":2}`},
+		{`{"id": 3, "action": "delete", "selector": "todos[completed]"}`, `{"id":3,"result":{"removed":1}}`},
+		{`{"id": 4, "action": "incr", "selector": "total"}`, `{"id":4,"result":1}`},
+		{`{"id": 5, "action": "decr", "selector": "total", "payload": 3}`, `{"id":5,"result":-2}`},
+		{`{"id": 6, "action": "max", "selector": "total", "payload": 5}`, `{"id":6,"result":5}`},
+		{`{"id": 7, "action": "min", "selector": "total", "payload": 2}`, `{"id":7,"result":2}`},
+	}
+
+	for _, r := range requests {
+		if got := sendSession(t, conn, r.req); got != r.want {
+			t.Errorf("%s: got %s, want %s", r.req, got, r.want)
+		}
+	}
+}
+
+// TestSessionSubscribeInvalid checks that a subscription with an invalid
+// selector doesn't keep its ID, so it can be tried again.
+func TestSessionSubscribeInvalid(t *testing.T) {
+	s, err := NewServer("", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	conn := dialSession(t, ts)
+	defer conn.Close()
+
+	got := sendSession(t, conn, `{"id": 1, "action": "subscribe", "selector": "todos["}`)
+	if !strings.HasPrefix(got, `{"id":1,"err":`) {
+		t.Errorf("expected an error, but got %s", got)
+	}
+
+	got = sendSession(t, conn, `{"id": 1, "action": "subscribe", "selector": "total"}`)
+	if want := `{"id":1,"result":0}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPaging(t *testing.T) {
+	s, err := NewServer("", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	for i := 0; i < 5; i++ {
+		post(t, ts.URL+"/append?selector=todos", fmt.Sprintf(`{"completed": false, "description": "%d"}`, i))
+	}
+
+	cases := []struct {
+		query, want string
+	}{
+		{"offset=1&limit=2", `["1", "2"]`},
+		{"offset=3", `["3", "4"]`},
+		{"limit=2", `["0", "1"]`},
+		{"limit=0", `[]`},
+		{"offset=9", `[]`},
+		{"offset=2&limit=9223372036854775807", `["2", "3", "4"]`},
+		{"offset=9223372036854775807&limit=9223372036854775807", `[]`},
+	}
+
+	for _, c := range cases {
+		u := ts.URL + "/json?selector=todos.description&" + c.query
+		if got := get(t, u); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.query, got, c.want)
+		}
+	}
+
+	invalid := []string{
+		"selector=todos&offset=-1",
+		"selector=todos&limit=x",
+		"selector=todos&limit=1.5",
+		"selector=todos&offset=1&offset=2",
+		"selector=todos&limit=99999999999999999999",
+		"selector=total&limit=1",
+	}
+
+	for _, query := range invalid {
+		res, err := http.Get(ts.URL + "/json?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s: got status %d, want an error", query, res.StatusCode)
+		}
+	}
+}
+
+func TestUpdateRoute(t *testing.T) {
+	s, err := NewServer("", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	for _, d := range []string{"a", "b", "c"} {
+		post(t, ts.URL+"/append?selector=todos", fmt.Sprintf(`{"completed": false, "description": "%s"}`, d))
+	}
+
+	updates := []struct {
+		query, body string
+	}{
+		{"selector=" + url.QueryEscape(`todos[description = "a"]`), `{"completed": true}`},
+		{"selector=" + url.QueryEscape("todos[description = $d]") + "&params=" + url.QueryEscape(`{"d": "b"}`), `"description = upper(description)"`},
+		{"selector=" + url.QueryEscape("todos[1]"), `"completed = !completed"`},
+	}
+
+	for _, u := range updates {
+		if got := post(t, ts.URL+"/update?"+u.query, u.body); got != "" {
+			t.Errorf("%s: got %s, want an empty response", u.query, got)
+		}
+	}
+
+	want := `[{"completed": true, "description": "a"}, {"completed": true, "description": "B"}, {"completed": false, "description": "c"}]`
+
+	if got := get(t, ts.URL+"/json?selector=todos"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	invalid := []struct {
+		selector, body string
+	}{
+		{"todos", `5`},
+		{"todos", `"completed ="`},
+		{"todos", `"nope = 1"`},
+		{"todos", `{"completed": "yes"}`},
+		{"todos", `"completed = true, description = 1"`},
+		{"todos.completed", `"completed = true"`},
+		{"total", `"completed = true"`},
+		{"todos", ``},
+	}
+
+	for _, u := range invalid {
+		res, err := http.Post(ts.URL+"/update?selector="+url.QueryEscape(u.selector), "text/json", strings.NewReader(u.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s with %s: got status %d, want an error", u.selector, u.body, res.StatusCode)
+		}
+	}
+
+	if got := get(t, ts.URL+"/json?selector=todos"); got != want {
+		t.Errorf("got %s after invalid updates, want %s", got, want)
+	}
+}
+
+func dialSession(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/session", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// sendSession sends a request over a session, and returns the next message
+// which is sent back.
+func sendSession(t *testing.T, conn *websocket.Conn, req string) string {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimSpace(string(msg))
+}
+
+func post(t *testing.T, u, body string) string {
+	res, err := http.Post(u, "text/json", strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+
+	return readResponse(t, u, res)
+}
+
+func get(t *testing.T, u string) string {
+	res, err := http.Get(u)
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+
+	return readResponse(t, u, res)
+}
+
+func readResponse(t *testing.T, u string, res *http.Response) string {
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("%s: %s", u, body)
+	}
+
+	return string(body)
+}
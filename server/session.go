@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Zac-Garby/siphon/db"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// A sessionRequest is a single frame sent by a client in a session. Action is
+// either the name of one of the HTTP routes, e.g. "json" or "set", and the
+// other fields correspond to the query parameters and body of that route, or
+// "subscribe" or "unsubscribe". A subscription is identified by the ID of the
+// request which started it.
+type sessionRequest struct {
+	ID         interface{}            `json:"id"`
+	Action     string                 `json:"action"`
+	Selector   string                 `json:"selector"`
+	Params     map[string]interface{} `json:"params"`
+	Payload    interface{}            `json:"payload"`
+	Operations []*db.Operation        `json:"operations"`
+}
+
+// A sessionResponse is sent in reply to each sessionRequest, with the same
+// ID. Exactly one of Result and Err is set, unless the request had no
+// result, e.g. a successful "set".
+type sessionResponse struct {
+	ID     interface{}     `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Err    string          `json:"err,omitempty"`
+}
+
+// A session is a websocket connection with a client.
+type session struct {
+	conn *websocket.Conn
+
+	// writeMu is held while writing to the connection, since responses to
+	// subscriptions are sent from other goroutines.
+	writeMu sync.Mutex
+
+	// subs maps the IDs of the client's subscriptions to channels which stop
+	// them when closed.
+	subs map[interface{}]chan struct{}
+}
+
+func (sess *session) send(resp *sessionResponse) error {
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+
+	return sess.conn.WriteJSON(resp)
+}
+
+// handleSession upgrades the connection to a websocket, and then handles
+// requests sent over it until the client disconnects. Requests are handled
+// in the order they're received.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		return
+	}
+
+	sess := &session{
+		conn: conn,
+		subs: make(map[interface{}]chan struct{}),
+	}
+
+	defer func() {
+		for _, stop := range sess.subs {
+			close(stop)
+		}
+
+		conn.Close()
+	}()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var (
+			req  = &sessionRequest{}
+			resp = &sessionResponse{}
+		)
+
+		if err := db.DecodeJSON(msg, req); err != nil {
+			resp.Err = err.Error()
+		} else if req.Action == "subscribe" {
+			// the first response is sent by the subscription itself
+			s.subscribe(sess, req)
+			continue
+		} else {
+			resp.ID = req.ID
+
+			result, err := s.dispatch(sess, req)
+			if err != nil {
+				resp.Err = err.Error()
+			} else if result != "" {
+				resp.Result = json.RawMessage(result)
+			}
+		}
+
+		if err := sess.send(resp); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch handles a session request in the same way as the corresponding
+// HTTP route, returning the JSON result, if there is one.
+func (s *Server) dispatch(sess *session, req *sessionRequest) (result string, err error) {
+	switch req.Action {
+	case "json":
+		return s.query(req.Selector, req.Params)
+
+	case "snapshot":
+		return "", s.Snapshot()
+
+	case "unsubscribe":
+		stop, ok := sess.subs[req.ID]
+		if !ok {
+			return "", fmt.Errorf("no subscription with id %v", req.ID)
+		}
+
+		close(stop)
+		delete(sess.subs, req.ID)
+
+		return "", nil
+
+	default:
+		op := &db.Operation{
+			Action:     db.Action(req.Action),
+			Selector:   req.Selector,
+			Params:     req.Params,
+			Payload:    req.Payload,
+			Operations: req.Operations,
+		}
+
+		if err := s.apply(op); err != nil {
+			return "", err
+		}
+
+		return operationResult(op), nil
+	}
+}
+
+// subscribe starts a subscription in a session. A response with the request's
+// ID is sent straight away, and then again every time the result changes,
+// until the client unsubscribes.
+func (s *Server) subscribe(sess *session, req *sessionRequest) {
+	if _, ok := sess.subs[req.ID]; ok {
+		sess.send(&sessionResponse{
+			ID:  req.ID,
+			Err: fmt.Sprintf("a subscription with id %v already exists", req.ID),
+		})
+
+		return
+	}
+
+	// if the selector is invalid, the subscription never starts, so its ID
+	// isn't taken
+	if err := db.SelectorParser.ParseString(req.Selector, &db.Selector{}); err != nil {
+		sess.send(&sessionResponse{
+			ID:  req.ID,
+			Err: err.Error(),
+		})
+
+		return
+	}
+
+	stop := make(chan struct{})
+	sess.subs[req.ID] = stop
+
+	go s.watch(req.Selector, req.Params, stop, func(result string, err error) error {
+		resp := &sessionResponse{
+			ID: req.ID,
+		}
+
+		if err != nil {
+			resp.Err = err.Error()
+		} else {
+			resp.Result = json.RawMessage(result)
+		}
+
+		return sess.send(resp)
+	})
+}
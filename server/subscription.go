@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Zac-Garby/siphon/db"
+)
+
+// A subscription is notified whenever one of the top-level fields which its
+// selector refers to is modified.
+type subscription struct {
+	fields []string
+
+	// changed is buffered, so that any number of modifications made while
+	// the subscriber is busy only cause it to query the database once.
+	changed chan struct{}
+}
+
+// A registry keeps track of subscriptions, indexed by the top-level fields
+// they're interested in.
+type registry struct {
+	mu   sync.Mutex
+	subs map[string]map[*subscription]bool
+}
+
+func (r *registry) add(fields []string) *subscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.subs == nil {
+		r.subs = make(map[string]map[*subscription]bool)
+	}
+
+	sub := &subscription{
+		fields:  fields,
+		changed: make(chan struct{}, 1),
+	}
+
+	for _, field := range fields {
+		if r.subs[field] == nil {
+			r.subs[field] = make(map[*subscription]bool)
+		}
+
+		r.subs[field][sub] = true
+	}
+
+	return sub
+}
+
+func (r *registry) remove(sub *subscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, field := range sub.fields {
+		delete(r.subs[field], sub)
+
+		if len(r.subs[field]) == 0 {
+			delete(r.subs, field)
+		}
+	}
+}
+
+// notify tells every subscription interested in any of the given fields that
+// they've been modified. Subscriptions interested in db.AllFields are always
+// notified, and if fields contains db.AllFields, every subscription is.
+func (r *registry) notify(fields []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	notified := make(map[*subscription]bool)
+
+	notifyField := func(field string) {
+		for sub := range r.subs[field] {
+			if notified[sub] {
+				continue
+			}
+
+			notified[sub] = true
+
+			select {
+			case sub.changed <- struct{}{}:
+			default:
+				// already notified, but hasn't queried again yet
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if field == db.AllFields {
+			for name := range r.subs {
+				notifyField(name)
+			}
+
+			return
+		}
+
+		notifyField(field)
+	}
+
+	notifyField(db.AllFields)
+}
+
+// apply applies an operation to the database, and then notifies any
+// subscriptions which might be affected by it.
+func (s *Server) apply(op *db.Operation) error {
+	if err := s.Database.Apply(op); err != nil {
+		return err
+	}
+
+	fields, err := op.Fields()
+	if err != nil {
+		return err
+	}
+
+	s.subscriptions.notify(fields)
+
+	return nil
+}
+
+// watch queries the database with a selector and calls send with the result.
+// After that, send is called again every time the result changes, until stop
+// is closed or send returns an error.
+func (s *Server) watch(selector string, params map[string]interface{}, stop <-chan struct{}, send func(result string, err error) error) error {
+	sel := &db.Selector{}
+	if err := db.SelectorParser.ParseString(selector, sel); err != nil {
+		return send("", err)
+	}
+
+	sub := s.subscriptions.add(sel.Fields())
+	defer s.subscriptions.remove(sub)
+
+	var (
+		last, lastErr string
+		first         = true
+	)
+
+	for {
+		result, err := s.query(selector, params)
+
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+		}
+
+		// the JSON of an item is always the same if the item hasn't
+		// changed, so comparing it is enough
+		if first || result != last || errMsg != lastErr {
+			if err := send(result, err); err != nil {
+				return err
+			}
+		}
+
+		last, lastErr, first = result, errMsg, false
+
+		select {
+		case <-sub.changed:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		errorMessage(w, "only GET is supported for /subscribe")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorMessage(w, "streaming is not supported by this connection")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		errorMessage(w, err.Error())
+		return
+	}
+
+	if len(r.Form["selector"]) != 1 {
+		errorMessage(w, "only one form value expected for the selector")
+		return
+	}
+
+	selector, err := url.QueryUnescape(r.Form["selector"][0])
+	if err != nil {
+		errorMessage(w, "could not unescape selector: "+r.Form["selector"][0])
+		return
+	}
+
+	params, err := parseParams(r)
+	if err != nil {
+		errorMessage(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	s.watch(selector, params, r.Context().Done(), func(result string, err error) error {
+		if err != nil {
+			msg, _ := json.Marshal(map[string]string{
+				"err": err.Error(),
+			})
+
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", msg)
+		} else {
+			fmt.Fprintf(w, "data: %s\n\n", result)
+		}
+
+		flusher.Flush()
+
+		return nil
+	})
+}
@@ -2,15 +2,16 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
+
+	"github.com/Zac-Garby/siphon/client"
+	"github.com/Zac-Garby/siphon/db"
 )
 
 func main() {
@@ -18,10 +19,10 @@ func main() {
 		log.Fatal("usage: cli <address>")
 	}
 
-	repl(os.Stdin, os.Args[1])
+	repl(os.Stdin, client.NewClient(os.Args[1]))
 }
 
-func repl(in io.Reader, addr string) {
+func repl(in io.Reader, c *client.Client) {
 	r := bufio.NewReader(in)
 
 	for {
@@ -65,69 +66,68 @@ func repl(in io.Reader, addr string) {
 			}
 		}
 
-		if err := request(addr, action, selector, data); err != nil {
+		if err := request(c, action, selector, data); err != nil {
 			fmt.Println("err:", err)
+			fmt.Println("ERR")
+		} else {
+			fmt.Println("OK")
 		}
 		fmt.Println()
 	}
 }
 
-func request(addr, action, selector, data string) error {
-	if !(action == "json" || action == "set" || action == "append" || action == "prepend" || action == "key" || action == "unset" || action == "empty") {
-		return fmt.Errorf("invalid request action: %s", action)
-	}
+func request(c *client.Client, action, selector, data string) error {
+	var (
+		ctx     = context.Background()
+		payload interface{}
+	)
 
-	u, err := url.Parse(addr)
-	if err != nil {
-		return fmt.Errorf("addr parser: %s", err.Error())
+	if data != "" {
+		if err := db.DecodeJSON([]byte(data), &payload); err != nil {
+			return fmt.Errorf("json decode: %s", err.Error())
+		}
 	}
 
-	u.Path = "/" + action
+	switch action {
+	case "json":
+		// kept as raw JSON, so that large numbers are printed exactly
+		var response json.RawMessage
+		if err := c.Get(ctx, selector, nil, &response); err != nil {
+			return err
+		}
 
-	q := u.Query()
-	q.Set("selector", url.PathEscape(selector))
-	u.RawQuery = q.Encode()
+		out, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json marshal: %s", err.Error())
+		}
 
-	var resp *http.Response
-	if action == "json" {
-		resp, err = http.Get(u.String())
-	} else {
-		resp, err = http.Post(u.String(), "text/json", strings.NewReader(data))
-	}
-	if err != nil {
-		return fmt.Errorf("http: %s", err.Error())
-	}
+		fmt.Println(string(out))
+		return nil
 
-	defer resp.Body.Close()
+	case "set":
+		return c.Set(ctx, selector, nil, payload)
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("read response: %s", err.Error())
-	}
+	case "unset":
+		return c.Unset(ctx, selector, nil, payload)
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusInternalServerError {
-		return fmt.Errorf("http err: %s", resp.Status)
-	}
+	case "append":
+		return c.Append(ctx, selector, nil, payload)
 
-	if len(body) > 0 {
-		var response interface{}
-		if err := json.Unmarshal(body, &response); err != nil {
-			return fmt.Errorf("json decode: %s\n%s", err.Error(), string(body))
-		}
+	case "prepend":
+		return c.Prepend(ctx, selector, nil, payload)
 
-		out, err := json.MarshalIndent(response, "", "  ")
-		if err != nil {
-			return fmt.Errorf("json marshal: %s", err.Error())
+	case "key":
+		kv, ok := payload.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object of the form {\"key\": ..., \"value\": ...}")
 		}
 
-		fmt.Println(string(out))
-	}
+		return c.Key(ctx, selector, nil, kv["key"], kv["value"])
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		fmt.Println("ERR")
-	} else {
-		fmt.Println(http.StatusText(resp.StatusCode))
-	}
+	case "empty":
+		return c.Empty(ctx, selector, nil)
 
-	return nil
+	default:
+		return fmt.Errorf("invalid request action: %s", action)
+	}
 }